@@ -9,4 +9,4 @@ CGO_ENABLED=1 GOOS=linux GOARCH=amd64 go build -o internal/core/runner/nodejs/no
 echo "Building main" &&
 GOOS=linux GOARCH=amd64 go build -o main -ldflags="-s -w" cmd/server/main.go
 echo "Building env"
-GOOS=linux GOARCH=amd64 go build -o env -ldflags="-s -w" cmd/dependencies/init.go
\ No newline at end of file
+GOOS=linux GOARCH=amd64 go build -o env -ldflags="-s -w" ./cmd/dependencies
\ No newline at end of file
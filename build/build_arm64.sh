@@ -9,4 +9,4 @@ CGO_ENABLED=1 GOOS=linux GOARCH=arm64 go build -o internal/core/runner/nodejs/no
 echo "Building main" &&
 GOOS=linux GOARCH=arm64 go build -o main -ldflags="-s -w" cmd/server/main.go
 echo "Building env"
-GOOS=linux GOARCH=arm64 go build -o env -ldflags="-s -w" cmd/dependencies/init.go
+GOOS=linux GOARCH=arm64 go build -o env -ldflags="-s -w" ./cmd/dependencies
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"os"
+
 	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
 	"github.com/langgenius/dify-sandbox/internal/static"
 	"github.com/langgenius/dify-sandbox/internal/utils/log"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "vendor" {
+		vendor(os.Args[2:])
+		return
+	}
+
 	static.InitConfig("conf/config.yaml")
 
 	err := python.PreparePythonDependenciesEnv()
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	nodejs_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/nodejs/dependencies"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
+	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+)
+
+const vendor_usage = `usage: dependencies vendor [flags]
+
+downloads the wheels of the python requirements of every dependency profile and
+their dependencies into a wheelhouse, copy it to an air-gapped machine and point
+python_wheelhouse of its config.yaml at it, with -nodejs-cache the node modules
+of the nodejs requirements are downloaded into an npm cache for nodejs_npm_cache
+
+flags:
+`
+
+func vendor(args []string) {
+	flags := flag.NewFlagSet("vendor", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, vendor_usage)
+		flags.PrintDefaults()
+	}
+	output := flags.String("output", "wheelhouse", "directory to download the wheels to")
+	platform := flags.String("platform", "", "platform of the target machine if it differs, e.g. manylinux2014_x86_64")
+	python_version := flags.String("python-version", "", "python version of the target machine if it differs, e.g. 3.10")
+	nodejs_cache := flags.String("nodejs-cache", "", "directory of an npm cache to download the node modules to")
+	flags.Parse(args)
+
+	err := static.InitConfig("conf/config.yaml")
+	if err != nil {
+		log.Panic("failed to init config: %v", err)
+	}
+
+	err = static.SetupRunnerDependencies()
+	if err != nil {
+		log.Panic("failed to read python requirements: %v", err)
+	}
+
+	// pip runs in a temporary directory
+	wheelhouse, err := filepath.Abs(*output)
+	if err != nil {
+		log.Panic("invalid output directory: %v", err)
+	}
+
+	err = os.MkdirAll(wheelhouse, 0755)
+	if err != nil {
+		log.Panic("failed to create %s: %v", wheelhouse, err)
+	}
+
+	for _, env := range python.Envs() {
+		requirements := static.GetRunnerDependencies().PythonRequirements[env.Profile]
+		if requirements == "" {
+			continue
+		}
+
+		log.Info("downloading python dependencies of profile %s...", env.Profile)
+		err := python.DownloadDependencies(env.Profile, requirements, wheelhouse, *platform, *python_version)
+		if err != nil {
+			log.Panic("failed to download python dependencies of profile %s: %v", env.Profile, err)
+		}
+	}
+
+	log.Info("python dependencies downloaded to %s", wheelhouse)
+
+	if *nodejs_cache == "" {
+		return
+	}
+
+	// npm runs in a temporary directory as well
+	cache, err := filepath.Abs(*nodejs_cache)
+	if err != nil {
+		log.Panic("invalid npm cache directory: %v", err)
+	}
+
+	log.Info("downloading nodejs dependencies...")
+	err = nodejs_dependencies.DownloadDependencies(static.GetRunnerDependencies().NodejsRequirements, cache, os.Stdout)
+	if err != nil {
+		log.Panic("failed to download nodejs dependencies: %v", err)
+	}
+	log.Info("nodejs dependencies downloaded to %s", cache)
+}
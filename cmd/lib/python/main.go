@@ -1,13 +1,21 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/langgenius/dify-sandbox/internal/core/lib/python"
 )
 import "C"
 
 //export DifySeccomp
 func DifySeccomp(uid int, gid int, enable_network bool) {
-	python.InitSeccomp(uid, gid, enable_network)
+	err := python.InitSeccomp(uid, gid, enable_network)
+	if err != nil {
+		// never run untrusted code in a partially initialized sandbox
+		fmt.Fprintf(os.Stderr, "error: failed to initialize sandbox: %v\n", err)
+		os.Exit(-1)
+	}
 }
 
 func main() {}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/langgenius/dify-sandbox/internal/core/runner"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
+	"github.com/langgenius/dify-sandbox/internal/service"
+	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `usage: profile learn [flags] <script>
+
+runs a trusted script with every syscall allowed and writes a seccomp profile
+which allows exactly the syscalls it made
+
+flags:
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "learn" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("learn", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	language := flags.String("language", "python3", "language of the script, python3 or nodejs")
+	name := flags.String("name", "learned", "name of the generated profile")
+	output := flags.String("output", "", "file to write the profile to, stdout if empty")
+	enable_network := flags.Bool("enable-network", false, "run the script with network enabled")
+	flags.Parse(os.Args[2:])
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	code, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Panic("failed to read script: %v", err)
+	}
+
+	err = static.InitConfig("conf/config.yaml")
+	if err != nil {
+		log.Panic("failed to init config: %v", err)
+	}
+
+	runner.Setup()
+
+	if *language == "python3" {
+		err = python.PreparePythonDependenciesEnv()
+		if err != nil {
+			log.Panic("failed to initialize python dependencies sandbox: %v", err)
+		}
+	}
+
+	resp := service.LearnSeccompProfile(*language, *name, string(code), *enable_network)
+	if resp.Code != 0 {
+		log.Panic("failed to learn seccomp profile: %s", resp.Message)
+	}
+
+	result := resp.Data.(*service.LearnSeccompProfileResponse)
+	fmt.Fprint(os.Stderr, result.Stdout)
+	fmt.Fprint(os.Stderr, result.Stderr)
+
+	buf := bytes.NewBufferString(fmt.Sprintf("# learned from %s by `profile learn`, review it before use\n", flags.Arg(0)))
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(result.Profile)
+	if err != nil {
+		log.Panic("failed to encode seccomp profile: %v", err)
+	}
+	data := buf.Bytes()
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+
+	err = os.WriteFile(*output, data, 0644)
+	if err != nil {
+		log.Panic("failed to write seccomp profile: %v", err)
+	}
+	log.Info("seccomp profile %s written to %s", *name, *output)
+}
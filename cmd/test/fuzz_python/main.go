@@ -8,7 +8,8 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/langgenius/dify-sandbox/internal/static/python_syscall"
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
 )
 
 const (
@@ -39,8 +40,17 @@ func find_syscall(syscall int, syscalls []int) int {
 }
 
 func main() {
-	original := python_syscall.ALLOW_SYSCALLS
-	original = append(original, python_syscall.ALLOW_NETWORK_SYSCALLS...)
+	profile, err := seccomp_profile.Get(
+		seccomp_profile.SecurityProfileName("python3", seccomp_profile.SECURITY_PROFILE_STANDARD),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	original, err := lib.ProfileSyscalls(profile, true)
+	if err != nil {
+		panic(err)
+	}
 
 	// generate task list
 	list := make([][]int, SYSCALL_NUMS)
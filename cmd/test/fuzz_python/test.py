@@ -1,11 +1,11 @@
 import ctypes
 import os
 
-lib = ctypes.CDLL("/var/sandbox/sandbox-python/python.so")
+lib = ctypes.CDLL("/var/sandbox/sandbox-python/current/python.so")
 lib.DifySeccomp.argtypes = [ctypes.c_uint32, ctypes.c_uint32, ctypes.c_bool]
 lib.DifySeccomp.restype = None
 
-os.chdir("/var/sandbox/sandbox-python")
+os.chdir("/var/sandbox/sandbox-python/current")
 
 lib.DifySeccomp(65537, 1000, 1)
 
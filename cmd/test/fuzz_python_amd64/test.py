@@ -12,7 +12,7 @@ def excepthook(type, value, tb):
 
 sys.excepthook = excepthook
 
-lib = ctypes.CDLL("/var/sandbox/sandbox-python/python.so")
+lib = ctypes.CDLL("/var/sandbox/sandbox-python/current/python.so")
 lib.DifySeccomp.argtypes = [ctypes.c_uint32, ctypes.c_uint32, ctypes.c_bool]
 lib.DifySeccomp.restype = None
 
@@ -25,7 +25,7 @@ import sys
 import traceback
 import os
 
-os.chdir("/var/sandbox/sandbox-python")
+os.chdir("/var/sandbox/sandbox-python/current")
 
 lib.DifySeccomp(65537, 1001, 1)
 
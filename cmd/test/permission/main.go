@@ -1,13 +1,38 @@
 package main
 
 import (
-	"os/exec"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/langgenius/dify-sandbox/internal/core/lib/python"
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/static"
 )
 
+// drops privileges with the threads of the runtime running and prints the ids and capabilities
+// of every thread, run as root
 func main() {
-	python.InitSeccomp(0, 0, true)
+	err := lib.DropPrivileges(static.SANDBOX_USER_UID, static.SANDBOX_USER_UID)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	exec.Command("/bin/sh", "-c", "echo hello").Run()
+	statuses, _ := filepath.Glob("/proc/self/task/*/status")
+	for _, status := range statuses {
+		content, err := os.ReadFile(status)
+		if err != nil {
+			continue
+		}
+
+		fmt.Println("thread", filepath.Base(filepath.Dir(status)))
+		for _, line := range strings.Split(string(content), "\n") {
+			name, _, _ := strings.Cut(line, ":")
+			switch name {
+			case "Uid", "Gid", "Groups", "CapInh", "CapPrm", "CapEff", "CapBnd", "CapAmb":
+				fmt.Println(line)
+			}
+		}
+	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/langgenius/dify-sandbox/internal/core/runner"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/service"
@@ -11,6 +12,7 @@ import (
 
 func main() {
 	static.InitConfig("conf/config.yaml")
+	runner.Setup()
 	python.PreparePythonDependenciesEnv()
 	resp := service.RunPython3Code(`import json;print(json.dumps({"hello": "world"}))`,
 		``,
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-sandbox/internal/service"
+	"github.com/langgenius/dify-sandbox/internal/types"
+)
+
+func VerifyChroot(c *gin.Context) {
+	BindRequest(c, func(req struct {
+		Language string `json:"language" form:"language" binding:"required"`
+		Profile  string `json:"profile" form:"profile"`
+		Rebuild  bool   `json:"rebuild" form:"rebuild"`
+	}) {
+		switch req.Language {
+		case "python3":
+			c.JSON(200, service.VerifyPython3Chroot(req.Profile, req.Rebuild))
+		default:
+			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
+		}
+	})
+}
+
+func RollbackChroot(c *gin.Context) {
+	BindRequest(c, func(req struct {
+		Language string `json:"language" form:"language" binding:"required"`
+		Profile  string `json:"profile" form:"profile"`
+	}) {
+		switch req.Language {
+		case "python3":
+			c.JSON(200, service.RollbackPython3Chroot(req.Profile))
+		default:
+			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
+		}
+	})
+}
@@ -0,0 +1,10 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-sandbox/internal/service"
+)
+
+func GetMetrics(c *gin.Context) {
+	c.JSON(200, service.GetMetrics())
+}
@@ -22,6 +22,20 @@ func Setup(Router *gin.Engine) {
 
 	InitRunRouter(PrivateGroup)
 	InitDependencyRouter(PrivateGroup)
+	InitMetricsRouter(PrivateGroup)
+	InitChrootRouter(PrivateGroup)
+}
+
+func InitMetricsRouter(Router *gin.RouterGroup) {
+	Router.GET("metrics", GetMetrics)
+}
+
+func InitChrootRouter(Router *gin.RouterGroup) {
+	chrootRouter := Router.Group("chroot")
+	{
+		chrootRouter.POST("verify", VerifyChroot)
+		chrootRouter.POST("rollback", RollbackChroot)
+	}
 }
 
 func InitDependencyRouter(Router *gin.RouterGroup) {
@@ -30,6 +44,11 @@ func InitDependencyRouter(Router *gin.RouterGroup) {
 		dependencyRouter.GET("", GetDependencies)
 		dependencyRouter.POST("update", UpdateDependencies)
 		dependencyRouter.GET("refresh", RefreshDependencies)
+		dependencyRouter.POST("add", AddDependency)
+		dependencyRouter.POST("remove", RemoveDependency)
+		dependencyRouter.GET("schedule", GetDependencySchedule)
+		dependencyRouter.GET("jobs", ListDependencyJobs)
+		dependencyRouter.GET("jobs/:id", GetDependencyJob)
 	}
 }
 
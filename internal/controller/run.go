@@ -9,19 +9,24 @@ import (
 
 func RunSandboxController(c *gin.Context) {
 	BindRequest(c, func(req struct {
-		Language      string `json:"language" form:"language" binding:"required"`
-		Code          string `json:"code" form:"code" binding:"required"`
-		Preload       string `json:"preload" form:"preload"`
-		EnableNetwork bool   `json:"enable_network" form:"enable_network"`
+		Language        string `json:"language" form:"language" binding:"required"`
+		Code            string `json:"code" form:"code" binding:"required"`
+		Preload         string `json:"preload" form:"preload"`
+		EnableNetwork   bool   `json:"enable_network" form:"enable_network"`
+		SecurityProfile string `json:"security_profile" form:"security_profile"`
+		Profile         string `json:"profile" form:"profile"`
 	}) {
 		switch req.Language {
 		case "python3":
 			c.JSON(200, service.RunPython3Code(req.Code, req.Preload, &runner_types.RunnerOptions{
-				EnableNetwork: req.EnableNetwork,
+				EnableNetwork:     req.EnableNetwork,
+				SecurityProfile:   req.SecurityProfile,
+				DependencyProfile: req.Profile,
 			}))
 		case "nodejs":
 			c.JSON(200, service.RunNodeJsCode(req.Code, req.Preload, &runner_types.RunnerOptions{
-				EnableNetwork: req.EnableNetwork,
+				EnableNetwork:   req.EnableNetwork,
+				SecurityProfile: req.SecurityProfile,
 			}))
 		default:
 			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
@@ -32,10 +37,13 @@ func RunSandboxController(c *gin.Context) {
 func GetDependencies(c *gin.Context) {
 	BindRequest(c, func(req struct {
 		Language string `json:"language" form:"language" binding:"required"`
+		Profile  string `json:"profile" form:"profile"`
 	}) {
 		switch req.Language {
 		case "python3":
-			c.JSON(200, service.ListPython3Dependencies())
+			c.JSON(200, service.ListPython3Dependencies(req.Profile))
+		case "nodejs":
+			c.JSON(200, service.ListNodejsDependencies(req.Profile))
 		default:
 			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
 		}
@@ -48,7 +56,9 @@ func UpdateDependencies(c *gin.Context) {
 	}) {
 		switch req.Language {
 		case "python3":
-			c.JSON(200, service.UpdateDependencies())
+			c.JSON(200, service.UpdatePython3Dependencies())
+		case "nodejs":
+			c.JSON(200, service.UpdateNodejsDependencies())
 		default:
 			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
 		}
@@ -58,12 +68,58 @@ func UpdateDependencies(c *gin.Context) {
 func RefreshDependencies(c *gin.Context) {
 	BindRequest(c, func(req struct {
 		Language string `json:"language" form:"language" binding:"required"`
+		Profile  string `json:"profile" form:"profile"`
+	}) {
+		switch req.Language {
+		case "python3":
+			c.JSON(200, service.RefreshPython3Dependencies(req.Profile))
+		case "nodejs":
+			c.JSON(200, service.RefreshNodejsDependencies(req.Profile))
+		default:
+			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
+		}
+	})
+}
+
+func AddDependency(c *gin.Context) {
+	BindRequest(c, func(req struct {
+		Language    string   `json:"language" form:"language" binding:"required"`
+		Profile     string   `json:"profile" form:"profile"`
+		Requirement string   `json:"requirement" form:"requirement" binding:"required"`
+		Hashes      []string `json:"hashes" form:"hashes"`
+	}) {
+		switch req.Language {
+		case "python3":
+			c.JSON(200, service.AddPython3Dependency(req.Profile, req.Requirement, req.Hashes))
+		default:
+			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
+		}
+	})
+}
+
+func RemoveDependency(c *gin.Context) {
+	BindRequest(c, func(req struct {
+		Language string `json:"language" form:"language" binding:"required"`
+		Profile  string `json:"profile" form:"profile"`
+		Name     string `json:"name" form:"name" binding:"required"`
 	}) {
 		switch req.Language {
 		case "python3":
-			c.JSON(200, service.RefreshPython3Dependencies())
+			c.JSON(200, service.RemovePython3Dependency(req.Profile, req.Name))
 		default:
 			c.JSON(400, types.ErrorResponse(-400, "unsupported language"))
 		}
 	})
 }
+
+func GetDependencySchedule(c *gin.Context) {
+	c.JSON(200, service.GetDependencySchedule())
+}
+
+func ListDependencyJobs(c *gin.Context) {
+	c.JSON(200, service.ListDependencyJobs())
+}
+
+func GetDependencyJob(c *gin.Context) {
+	c.JSON(200, service.GetDependencyJob(c.Param("id")))
+}
@@ -0,0 +1,372 @@
+package chroot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+	"golang.org/x/sys/unix"
+)
+
+// Builder copies host paths into a chroot environment at the same paths
+//
+// files are reflinked where the filesystem supports it and copied otherwise, the copy is
+// written next to the target and renamed over it, so a running execution never sees a file
+// being modified in place and no file is shared with the host or another version
+type Builder struct {
+	root          string
+	manifest_path string
+
+	// search_path enables the discovery of shared libraries needed by extension modules
+	search_path []string
+}
+
+type BuildResult struct {
+	Manifest *Manifest
+	// Copied counts files and symlinks which were new or changed
+	Copied    int
+	Unchanged int
+	// Removed counts files of the previous build which are not part of the sources anymore
+	Removed int
+	// Libraries were discovered as dependencies of extension modules and added besides the sources
+	Libraries  []string
+	Unresolved []UnresolvedLibrary
+}
+
+func NewBuilder(root string, manifest_path string) *Builder {
+	return &Builder{root: root, manifest_path: manifest_path}
+}
+
+// EnableLibraryDiscovery makes builds add the shared libraries extension modules in site-packages
+// depend on, they are looked up in search_path like the dynamic loader would
+func (b *Builder) EnableLibraryDiscovery(search_path []string) {
+	b.search_path = search_path
+}
+
+// Seed reflinks or copies the files of another build into the environment and takes over its
+// manifest, the following build then only copies what changed since. Every environment owns its
+// files, a write into one of them can not reach the other build. Files in exclude are left out
+// to be copied from the host again
+func (b *Builder) Seed(root string, manifest_path string, exclude []string) error {
+	other, err := LoadManifest(manifest_path)
+	if err != nil {
+		return err
+	}
+
+	skip := map[string]bool{}
+	for _, path := range exclude {
+		skip[path] = true
+	}
+
+	seeded := NewManifest()
+	for _, path := range other.Paths() {
+		if skip[path] {
+			continue
+		}
+
+		entry := other.Entries[path]
+		target := b.target(path)
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+
+		if entry.Link != "" {
+			err = os.Symlink(entry.Link, target)
+		} else {
+			err = cloneFile(filepath.Join(root, path), target, entry.Mode, nil)
+		}
+		if err != nil {
+			// not recorded, the build copies it
+			continue
+		}
+		seeded.Entries[path] = entry
+	}
+
+	return seeded.Save(b.manifest_path)
+}
+
+// Build brings the environment in line with the sources, only files which changed since
+// the previous build are touched
+func (b *Builder) Build(sources []string) (*BuildResult, error) {
+	previous, err := LoadManifest(b.manifest_path)
+	if err != nil {
+		log.Warn("failed to load manifest %s, rebuilding everything: %v", b.manifest_path, err)
+		previous = NewManifest()
+	}
+
+	result := &BuildResult{Manifest: NewManifest()}
+	for _, source := range sources {
+		source = filepath.Clean(source)
+
+		// sources are followed if they are symlinks, their content is needed inside the chroot
+		info, err := os.Stat(source)
+		if err != nil {
+			log.Warn("lib path %s is not available", source)
+			continue
+		}
+
+		if info.IsDir() {
+			err = b.addDir(source, previous, result)
+		} else if info.Mode().IsRegular() {
+			err = b.addFile(source, source, info, previous, result)
+		} else {
+			log.Warn("lib path %s is neither a file nor a directory", source)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if b.search_path != nil {
+		err = b.addLibraries(previous, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range previous.Paths() {
+		if _, ok := result.Manifest.Entries[path]; ok {
+			continue
+		}
+
+		err := os.Remove(b.target(path))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		b.removeEmptyParents(path)
+		result.Removed++
+	}
+
+	err = result.Manifest.Save(b.manifest_path)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// removeEmptyParents removes the directories of a removed path which are empty now, an empty
+// package directory would still be importable as a namespace package
+func (b *Builder) removeEmptyParents(path string) {
+	for dir := filepath.Dir(path); dir != "/" && dir != "." && dir != ""; dir = filepath.Dir(dir) {
+		// fails on directories which are not empty
+		if os.Remove(b.target(dir)) != nil {
+			return
+		}
+	}
+}
+
+func (b *Builder) target(path string) string {
+	return filepath.Join(b.root, path)
+}
+
+func (b *Builder) addDir(source string, previous *Manifest, result *BuildResult) error {
+	real_source, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(real_source, func(host_path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Warn("failed to read %s: %v", host_path, err)
+			return nil
+		}
+
+		path := source + strings.TrimPrefix(host_path, real_source)
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(b.target(path), 0755)
+		case entry.Type()&fs.ModeSymlink != 0:
+			return b.addSymlink(host_path, path, previous, result)
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			return b.addFile(host_path, path, info, previous, result)
+		default:
+			// devices, sockets and pipes have no business in the chroot
+			return nil
+		}
+	})
+}
+
+// addLibraries resolves the DT_NEEDED entries of extension modules, libraries which are not
+// part of the sources already are added at their host path
+func (b *Builder) addLibraries(previous *Manifest, result *BuildResult) error {
+	resolver := newLibraryResolver(b.search_path)
+	for _, path := range result.Manifest.Paths() {
+		if isExtensionModule(path) {
+			resolver.resolve(path)
+		}
+	}
+
+	for _, library := range resolver.libraries {
+		if _, ok := result.Manifest.Entries[library]; ok {
+			continue
+		}
+
+		info, err := os.Stat(library)
+		if err != nil {
+			return err
+		}
+
+		err = b.addFile(library, library, info, previous, result)
+		if err != nil {
+			return err
+		}
+		result.Libraries = append(result.Libraries, library)
+	}
+
+	result.Unresolved = resolver.unresolved
+	return nil
+}
+
+func (b *Builder) addFile(host_path string, path string, info fs.FileInfo, previous *Manifest, result *BuildResult) error {
+	if _, ok := result.Manifest.Entries[path]; ok {
+		// already added by an overlapping source
+		return nil
+	}
+
+	entry := ManifestEntry{
+		Path:    path,
+		Size:    info.Size(),
+		Mode:    info.Mode().Perm() &^ 0222,
+		ModTime: info.ModTime().UnixNano(),
+	}
+
+	if old, ok := previous.Entries[path]; ok && old.Link == "" && old.Size == entry.Size &&
+		old.Mode == entry.Mode && old.ModTime == entry.ModTime {
+		target_info, err := os.Lstat(b.target(path))
+		if err == nil && target_info.Mode().IsRegular() && target_info.Size() == entry.Size {
+			result.Manifest.Entries[path] = old
+			result.Unchanged++
+			return nil
+		}
+	}
+
+	hash, err := copyFile(host_path, b.target(path), entry.Mode)
+	if err != nil {
+		return err
+	}
+
+	entry.Hash = hash
+	result.Manifest.Entries[path] = entry
+	result.Copied++
+	return nil
+}
+
+func (b *Builder) addSymlink(host_path string, path string, previous *Manifest, result *BuildResult) error {
+	if _, ok := result.Manifest.Entries[path]; ok {
+		return nil
+	}
+
+	link, err := os.Readlink(host_path)
+	if err != nil {
+		return err
+	}
+
+	entry := ManifestEntry{
+		Path: path,
+		Mode: fs.ModeSymlink | 0777,
+		Link: link,
+	}
+
+	target := b.target(path)
+	if old, ok := previous.Entries[path]; ok && old.Link == link {
+		if current, err := os.Readlink(target); err == nil && current == link {
+			result.Manifest.Entries[path] = entry
+			result.Unchanged++
+			return nil
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp_path := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".tmp")
+	os.Remove(tmp_path)
+	err = os.Symlink(link, tmp_path)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp_path, target)
+	if err != nil {
+		os.Remove(tmp_path)
+		return err
+	}
+
+	result.Manifest.Entries[path] = entry
+	result.Copied++
+	return nil
+}
+
+// copyFile writes a read-only copy of src to dst and returns the sha256 of the content
+func copyFile(src string, dst string, mode fs.FileMode) (string, error) {
+	hasher := sha256.New()
+	err := cloneFile(src, dst, mode, hasher)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// cloneFile reflinks src to dst, or copies it if the filesystem does not support reflinks, the
+// content is written to hasher as well unless it is nil
+func cloneFile(src string, dst string, mode fs.FileMode, hasher io.Writer) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	src_file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer src_file.Close()
+
+	tmp_file, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp_file.Name())
+	defer tmp_file.Close()
+
+	err = unix.IoctlFileClone(int(tmp_file.Fd()), int(src_file.Fd()))
+	if err == nil {
+		// the content is shared until either file is written, it only has to be read for the hash
+		if hasher != nil {
+			_, err = io.Copy(hasher, src_file)
+		}
+	} else if hasher != nil {
+		_, err = io.Copy(io.MultiWriter(tmp_file, hasher), src_file)
+	} else {
+		_, err = io.Copy(tmp_file, src_file)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tmp_file.Chmod(mode)
+	if err != nil {
+		return err
+	}
+
+	err = tmp_file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp_file.Name(), dst)
+}
@@ -0,0 +1,246 @@
+package chroot
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestBuilder returns a builder of an environment below a temporary directory and a source
+// directory holding a file, a file in a package and a symlink
+func newTestBuilder(t *testing.T) (*Builder, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	root := filepath.Join(dir, "root")
+
+	writeFile(t, filepath.Join(source, "a.py"), "a")
+	writeFile(t, filepath.Join(source, "pkg", "b.py"), "bb")
+	err := os.Symlink("a.py", filepath.Join(source, "link.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewBuilder(root, filepath.Join(dir, "manifest.json")), source, root
+}
+
+func build(t *testing.T, builder *Builder, source string) *BuildResult {
+	t.Helper()
+
+	result, err := builder.Build([]string{source})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestBuild(t *testing.T) {
+	builder, source, root := newTestBuilder(t)
+
+	result := build(t, builder, source)
+	if result.Copied != 3 || result.Unchanged != 0 || result.Removed != 0 {
+		t.Fatalf("unexpected result of the first build: %+v", result)
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, source, "pkg", "b.py"))
+	if err != nil || string(content) != "bb" {
+		t.Fatalf("unexpected content %q, %v", content, err)
+	}
+
+	// copies are read-only
+	info, err := os.Stat(filepath.Join(root, source, "a.py"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0444 {
+		t.Errorf("unexpected mode %v", info.Mode().Perm())
+	}
+
+	link, err := os.Readlink(filepath.Join(root, source, "link.py"))
+	if err != nil || link != "a.py" {
+		t.Fatalf("unexpected link %q, %v", link, err)
+	}
+
+	entry := result.Manifest.Entries[filepath.Join(source, "a.py")]
+	if entry.Size != 1 || entry.Hash == "" || entry.Link != "" {
+		t.Errorf("unexpected manifest entry %+v", entry)
+	}
+}
+
+func TestBuildIncremental(t *testing.T) {
+	builder, source, root := newTestBuilder(t)
+	build(t, builder, source)
+
+	result := build(t, builder, source)
+	if result.Copied != 0 || result.Unchanged != 3 {
+		t.Fatalf("unchanged sources were copied again: %+v", result)
+	}
+
+	a := filepath.Join(source, "a.py")
+	b := filepath.Join(source, "pkg", "b.py")
+	for name, change := range map[string]func(){
+		// same size and mode, only the mtime tells
+		"mtime": func() {
+			writeFile(t, a, "A")
+			err := os.Chtimes(a, time.Now(), time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+		},
+		"mode": func() {
+			info, err := os.Stat(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.Chmod(a, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// keep the mtime, only the mode changes
+			err = os.Chtimes(a, info.ModTime(), info.ModTime())
+			if err != nil {
+				t.Fatal(err)
+			}
+		},
+		"size": func() {
+			info, err := os.Stat(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, a, "aaaa")
+			err = os.Chtimes(a, info.ModTime(), info.ModTime())
+			if err != nil {
+				t.Fatal(err)
+			}
+		},
+	} {
+		change()
+
+		result := build(t, builder, source)
+		if result.Copied != 1 || result.Unchanged != 2 {
+			t.Fatalf("%s: unexpected result %+v", name, result)
+		}
+
+		expected, _ := os.ReadFile(a)
+		content, err := os.ReadFile(filepath.Join(root, a))
+		if err != nil || string(content) != string(expected) {
+			t.Fatalf("%s: copy was not updated, %q, %v", name, content, err)
+		}
+	}
+
+	// a file missing from the environment is copied again even if the source did not change
+	err := os.Remove(filepath.Join(root, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result = build(t, builder, source)
+	if result.Copied != 1 || result.Unchanged != 2 {
+		t.Fatalf("missing file was not restored: %+v", result)
+	}
+}
+
+func TestBuildRemoved(t *testing.T) {
+	builder, source, root := newTestBuilder(t)
+	build(t, builder, source)
+
+	err := os.RemoveAll(filepath.Join(source, "pkg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := build(t, builder, source)
+	if result.Removed != 1 || result.Unchanged != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// an empty package directory would still be importable
+	_, err = os.Stat(filepath.Join(root, source, "pkg"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("empty directory of a removed file was left behind: %v", err)
+	}
+
+	if _, ok := result.Manifest.Entries[filepath.Join(source, "pkg", "b.py")]; ok {
+		t.Error("removed file is still part of the manifest")
+	}
+}
+
+func TestSeed(t *testing.T) {
+	builder, source, root := newTestBuilder(t)
+	build(t, builder, source)
+
+	dir := t.TempDir()
+	seeded := NewBuilder(filepath.Join(dir, "root"), filepath.Join(dir, "manifest.json"))
+
+	// the excluded file is copied from the host by the following build
+	a := filepath.Join(source, "a.py")
+	err := seeded.Seed(root, builder.manifest_path, []string{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := filepath.Join(source, "pkg", "b.py")
+	seeded_info, err := os.Stat(filepath.Join(dir, "root", b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(root, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(seeded_info, info) {
+		t.Error("seeded file is shared with the other build")
+	}
+
+	// a file written in place in the seeded environment leaves the other build intact
+	err = os.Chmod(filepath.Join(dir, "root", b), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "root", b), "xx")
+	content, err := os.ReadFile(filepath.Join(root, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "bb" {
+		t.Fatalf("a write into the seeded environment changed the other build: %q", content)
+	}
+	writeFile(t, filepath.Join(dir, "root", b), "bb")
+
+	result := build(t, seeded, source)
+	if result.Copied != 1 || result.Unchanged != 2 {
+		t.Fatalf("unexpected result of a seeded build: %+v", result)
+	}
+
+	// the seeded environment got its own copy, the other build is untouched
+	seeded_info, err = os.Stat(filepath.Join(dir, "root", a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(filepath.Join(root, a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(seeded_info, info) {
+		t.Error("excluded file was seeded")
+	}
+}
@@ -0,0 +1,176 @@
+package chroot
+
+import (
+	"bufio"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LD_SO_CONF lists the directories the dynamic loader of the host searches
+const LD_SO_CONF = "/etc/ld.so.conf"
+
+// DEFAULT_LIBRARY_PATHS are searched by the dynamic loader even if ld.so.conf does not list them
+var DEFAULT_LIBRARY_PATHS = []string{"/lib", "/usr/lib", "/lib64", "/usr/lib64"}
+
+// UnresolvedLibrary is a DT_NEEDED entry which was found nowhere on the host
+type UnresolvedLibrary struct {
+	Name     string `json:"name"`
+	NeededBy string `json:"needed_by"`
+}
+
+// LibrarySearchPath returns the directories the dynamic loader of the host searches,
+// in the order of LD_LIBRARY_PATH, ld.so.conf and the defaults
+func LibrarySearchPath() []string {
+	search_path := filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))
+	search_path = append(search_path, readLdSoConf(LD_SO_CONF, map[string]bool{})...)
+	search_path = append(search_path, DEFAULT_LIBRARY_PATHS...)
+
+	return search_path
+}
+
+func readLdSoConf(conf_path string, visited map[string]bool) []string {
+	if visited[conf_path] {
+		return nil
+	}
+	visited[conf_path] = true
+
+	file, err := os.Open(conf_path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	dirs := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if pattern, ok := strings.CutPrefix(line, "include "); ok {
+			pattern = strings.TrimSpace(pattern)
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(conf_path), pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				dirs = append(dirs, readLdSoConf(match, visited)...)
+			}
+			continue
+		}
+
+		dirs = append(dirs, line)
+	}
+
+	return dirs
+}
+
+// isExtensionModule reports whether a file of the environment may be a compiled python module
+func isExtensionModule(path string) bool {
+	if !strings.Contains(path, "/site-packages/") && !strings.Contains(path, "/dist-packages/") {
+		return false
+	}
+
+	name := filepath.Base(path)
+	return strings.HasSuffix(name, ".so") || strings.Contains(name, ".so.")
+}
+
+// libraryResolver resolves DT_NEEDED entries the way the dynamic loader does, recursively
+type libraryResolver struct {
+	search_path []string
+	// resolved maps host paths of libraries to whether their own dependencies were resolved
+	resolved   map[string]bool
+	libraries  []string
+	unresolved []UnresolvedLibrary
+}
+
+func newLibraryResolver(search_path []string) *libraryResolver {
+	return &libraryResolver{
+		search_path: search_path,
+		resolved:    map[string]bool{},
+	}
+}
+
+// resolve collects the libraries needed by an ELF file, files which are no ELF are ignored
+func (r *libraryResolver) resolve(host_path string) {
+	file, err := elf.Open(host_path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	needed, err := file.ImportedLibraries()
+	if err != nil {
+		return
+	}
+
+	rpaths := r.runPaths(file, host_path)
+	for _, name := range needed {
+		library, ok := r.find(name, rpaths, file)
+		if !ok {
+			r.unresolved = append(r.unresolved, UnresolvedLibrary{Name: name, NeededBy: host_path})
+			continue
+		}
+
+		if r.resolved[library] {
+			continue
+		}
+		r.resolved[library] = true
+		r.libraries = append(r.libraries, library)
+		r.resolve(library)
+	}
+}
+
+// runPaths returns DT_RUNPATH, or DT_RPATH if there is none, with $ORIGIN expanded
+func (r *libraryResolver) runPaths(file *elf.File, host_path string) []string {
+	entries, _ := file.DynString(elf.DT_RUNPATH)
+	if len(entries) == 0 {
+		entries, _ = file.DynString(elf.DT_RPATH)
+	}
+
+	origin := filepath.Dir(host_path)
+	if real_path, err := filepath.EvalSymlinks(host_path); err == nil {
+		origin = filepath.Dir(real_path)
+	}
+
+	paths := []string{}
+	for _, entry := range entries {
+		for _, dir := range filepath.SplitList(entry) {
+			dir = strings.ReplaceAll(dir, "${ORIGIN}", origin)
+			dir = strings.ReplaceAll(dir, "$ORIGIN", origin)
+			paths = append(paths, dir)
+		}
+	}
+
+	return paths
+}
+
+// find looks a library up like the dynamic loader, skipping libraries of another architecture
+func (r *libraryResolver) find(name string, rpaths []string, needed_by *elf.File) (string, bool) {
+	if strings.Contains(name, "/") {
+		return name, compatibleLibrary(name, needed_by)
+	}
+
+	for _, dir := range append(rpaths, r.search_path...) {
+		candidate := filepath.Join(dir, name)
+		if compatibleLibrary(candidate, needed_by) {
+			return filepath.Clean(candidate), true
+		}
+	}
+
+	return "", false
+}
+
+func compatibleLibrary(path string, needed_by *elf.File) bool {
+	file, err := elf.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	return file.Class == needed_by.Class && file.Machine == needed_by.Machine
+}
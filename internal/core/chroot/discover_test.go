@@ -0,0 +1,202 @@
+package chroot
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeLibrary writes a 64 bit little endian shared library which only has a dynamic section
+// naming the libraries it needs and its DT_RUNPATH, that is all the resolver reads
+func writeLibrary(t *testing.T, path string, machine elf.Machine, needed []string, runpath string) {
+	t.Helper()
+
+	dynstr := []byte{0}
+	addString := func(s string) uint64 {
+		offset := uint64(len(dynstr))
+		dynstr = append(append(dynstr, s...), 0)
+		return offset
+	}
+
+	dynamic := []elf.Dyn64{}
+	for _, name := range needed {
+		dynamic = append(dynamic, elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: addString(name)})
+	}
+	if runpath != "" {
+		dynamic = append(dynamic, elf.Dyn64{Tag: int64(elf.DT_RUNPATH), Val: addString(runpath)})
+	}
+	dynamic = append(dynamic, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+	for len(dynstr)%8 != 0 {
+		dynstr = append(dynstr, 0)
+	}
+
+	shstrtab := []byte("\x00.dynstr\x00.dynamic\x00.shstrtab\x00")
+	for len(shstrtab)%8 != 0 {
+		shstrtab = append(shstrtab, 0)
+	}
+
+	dynstr_offset := uint64(binary.Size(elf.Header64{}))
+	dynamic_offset := dynstr_offset + uint64(len(dynstr))
+	dynamic_size := uint64(binary.Size(dynamic))
+	shstrtab_offset := dynamic_offset + dynamic_size
+	sections_offset := shstrtab_offset + uint64(len(shstrtab))
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     sections_offset,
+		Ehsize:    uint16(binary.Size(elf.Header64{})),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     4,
+		Shstrndx:  3,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_STRTAB), Off: dynstr_offset, Size: uint64(len(dynstr)), Addralign: 1},
+		{Name: 9, Type: uint32(elf.SHT_DYNAMIC), Off: dynamic_offset, Size: dynamic_size, Link: 1, Addralign: 8, Entsize: 16},
+		{Name: 18, Type: uint32(elf.SHT_STRTAB), Off: shstrtab_offset, Size: uint64(len(shstrtab)), Addralign: 1},
+	}
+
+	buf := &bytes.Buffer{}
+	for _, data := range []any{header, dynstr, dynamic, shstrtab, sections} {
+		err := binary.Write(buf, binary.LittleEndian, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile(t, path, buf.String())
+}
+
+// hostLibrary returns a library of the host and its machine, the test is skipped without one
+func hostLibrary(t *testing.T, name string) (string, elf.Machine) {
+	t.Helper()
+
+	for _, dir := range LibrarySearchPath() {
+		file, err := elf.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		if file.Class != elf.ELFCLASS64 || file.ByteOrder != binary.LittleEndian {
+			continue
+		}
+		return filepath.Join(dir, name), file.Machine
+	}
+
+	t.Skipf("%s of a 64 bit little endian host was not found", name)
+	return "", 0
+}
+
+func TestReadLdSoConf(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "ld.so.conf")
+
+	writeFile(t, conf, "# comment\n/opt/first\ninclude conf.d/*.conf\n\n/opt/last # trailing\n")
+	writeFile(t, filepath.Join(dir, "conf.d", "a.conf"), "/opt/a\n")
+	// a loop of includes is only followed once
+	writeFile(t, filepath.Join(dir, "conf.d", "b.conf"), "include "+conf+"\n/opt/b\n")
+
+	dirs := readLdSoConf(conf, map[string]bool{})
+	expected := []string{"/opt/first", "/opt/a", "/opt/b", "/opt/last"}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Fatalf("unexpected directories %v", dirs)
+	}
+
+	if dirs := readLdSoConf(filepath.Join(dir, "missing.conf"), map[string]bool{}); len(dirs) != 0 {
+		t.Fatalf("unexpected directories of a missing file %v", dirs)
+	}
+}
+
+func TestResolveLibraries(t *testing.T) {
+	host_path, machine := hostLibrary(t, "libm.so.6")
+	host_libc, _ := hostLibrary(t, "libc.so.6")
+
+	dir := t.TempDir()
+	site_packages := filepath.Join(dir, "lib", "python3", "site-packages")
+
+	// a wheel vendoring a library next to its extension module, found through $ORIGIN
+	module := filepath.Join(site_packages, "pkg", "_ext.so")
+	writeLibrary(t, module, machine, []string{"libm.so.6", "libmissing.so.0"}, "$ORIGIN/../pkg.libs")
+	content, err := os.ReadFile(host_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vendored := filepath.Join(site_packages, "pkg.libs", "libm.so.6")
+	writeFile(t, vendored, string(content))
+
+	resolver := newLibraryResolver(LibrarySearchPath())
+	resolver.resolve(module)
+
+	resolved := map[string]bool{}
+	for _, library := range resolver.libraries {
+		resolved[library] = true
+	}
+	if !resolved[vendored] {
+		t.Fatalf("the library next to the module was not resolved through $ORIGIN: %v", resolver.libraries)
+	}
+	if resolved[host_path] {
+		t.Fatalf("the library of the host was resolved instead of the vendored one: %v", resolver.libraries)
+	}
+	// the vendored copy needs the libc of the host, found through the search path
+	if !resolved[filepath.Clean(host_libc)] {
+		t.Fatalf("the dependencies of the vendored library were not resolved: %v", resolver.libraries)
+	}
+
+	expected := []UnresolvedLibrary{{Name: "libmissing.so.0", NeededBy: module}}
+	if !reflect.DeepEqual(resolver.unresolved, expected) {
+		t.Fatalf("unexpected unresolved libraries %v", resolver.unresolved)
+	}
+
+	// the build adds the libraries of the host, the vendored one is part of the sources already
+	builder := NewBuilder(filepath.Join(dir, "root"), filepath.Join(dir, "manifest.json"))
+	builder.EnableLibraryDiscovery(LibrarySearchPath())
+	result := build(t, builder, site_packages)
+
+	added := map[string]bool{}
+	for _, library := range result.Libraries {
+		added[library] = true
+		if _, err := os.Stat(filepath.Join(dir, "root", library)); err != nil {
+			t.Fatalf("library %s was not copied into the environment: %v", library, err)
+		}
+	}
+	if added[vendored] || !added[filepath.Clean(host_libc)] {
+		t.Fatalf("unexpected libraries added to the environment %v", result.Libraries)
+	}
+	if !reflect.DeepEqual(result.Unresolved, expected) {
+		t.Fatalf("unexpected unresolved libraries of the build %v", result.Unresolved)
+	}
+}
+
+func TestResolveOtherArchitecture(t *testing.T) {
+	_, machine := hostLibrary(t, "libm.so.6")
+
+	other := elf.EM_AARCH64
+	if machine == elf.EM_AARCH64 {
+		other = elf.EM_X86_64
+	}
+
+	// a library of another architecture in the same directory does not satisfy the module
+	dir := t.TempDir()
+	module := filepath.Join(dir, "site-packages", "_ext.so")
+	writeLibrary(t, module, machine, []string{"libother.so"}, "$ORIGIN")
+	writeLibrary(t, filepath.Join(dir, "site-packages", "libother.so"), other, nil, "")
+
+	resolver := newLibraryResolver(nil)
+	resolver.resolve(module)
+
+	if len(resolver.libraries) != 0 || len(resolver.unresolved) != 1 {
+		t.Fatalf("unexpected resolution %v, %v", resolver.libraries, resolver.unresolved)
+	}
+}
@@ -0,0 +1,87 @@
+package chroot
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ManifestEntry describes a file of the environment, paths are the same on the host and inside the chroot
+type ManifestEntry struct {
+	Path string      `json:"path"`
+	Size int64       `json:"size"`
+	Mode fs.FileMode `json:"mode"`
+	// Hash is the sha256 of the content, empty for symlinks
+	Hash string `json:"hash,omitempty"`
+	// Link is the target of a symlink
+	Link string `json:"link,omitempty"`
+	// ModTime of the host file in unix nanoseconds, files whose size, mode and mtime did not change
+	// are not copied again by incremental rebuilds
+	ModTime int64 `json:"mod_time"`
+}
+
+// Manifest records every file the builder put into an environment
+type Manifest struct {
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{Entries: map[string]ManifestEntry{}}
+}
+
+// LoadManifest reads a manifest, a missing one is empty so the first build copies everything
+func LoadManifest(manifest_path string) (*Manifest, error) {
+	data, err := os.ReadFile(manifest_path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewManifest(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := NewManifest()
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Entries == nil {
+		manifest.Entries = map[string]ManifestEntry{}
+	}
+
+	return manifest, nil
+}
+
+// Save replaces the manifest atomically
+func (m *Manifest) Save(manifest_path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(manifest_path), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp_path := manifest_path + ".tmp"
+	err = os.WriteFile(tmp_path, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp_path, manifest_path)
+}
+
+// Paths returns the sorted paths of all entries
+func (m *Manifest) Paths() []string {
+	paths := make([]string, 0, len(m.Entries))
+	for path := range m.Entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
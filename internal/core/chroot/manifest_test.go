@@ -0,0 +1,67 @@
+package chroot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	manifest_path := filepath.Join(t.TempDir(), "manifests", "manifest.json")
+
+	// a missing manifest is empty
+	manifest, err := LoadManifest(manifest_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Entries) != 0 {
+		t.Fatalf("unexpected entries %v", manifest.Entries)
+	}
+
+	manifest.Entries["/usr/lib/b.so"] = ManifestEntry{Path: "/usr/lib/b.so", Size: 2, Mode: 0444, Hash: "ab", ModTime: 1}
+	manifest.Entries["/usr/lib/a.so"] = ManifestEntry{Path: "/usr/lib/a.so", Mode: 0777, Link: "b.so"}
+	err = manifest.Save(manifest_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadManifest(manifest_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, manifest) {
+		t.Fatalf("loaded manifest differs: %+v", loaded)
+	}
+
+	if paths := loaded.Paths(); !reflect.DeepEqual(paths, []string{"/usr/lib/a.so", "/usr/lib/b.so"}) {
+		t.Errorf("unexpected paths %v", paths)
+	}
+
+	if _, err := os.Stat(manifest_path + ".tmp"); err == nil {
+		t.Error("temporary manifest was left behind")
+	}
+}
+
+func TestManifestInvalid(t *testing.T) {
+	manifest_path := filepath.Join(t.TempDir(), "manifest.json")
+	err := os.WriteFile(manifest_path, []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadManifest(manifest_path)
+	if err == nil {
+		t.Fatal("invalid manifest was loaded")
+	}
+
+	// the builder starts over instead of failing
+	builder := NewBuilder(filepath.Join(t.TempDir(), "root"), manifest_path)
+	result, err := builder.Build(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Manifest.Entries) != 0 {
+		t.Errorf("unexpected entries %v", result.Manifest.Entries)
+	}
+}
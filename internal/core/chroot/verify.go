@@ -0,0 +1,123 @@
+package chroot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VerifyResult lists the files of an environment which differ from its manifest, by chroot path
+type VerifyResult struct {
+	// Added files are not part of the manifest, e.g. a .pth file dropped by an escaped script
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Deleted  []string `json:"deleted"`
+}
+
+// Intact reports whether the environment matches its manifest
+func (r *VerifyResult) Intact() bool {
+	return len(r.Added) == 0 && len(r.Modified) == 0 && len(r.Deleted) == 0
+}
+
+// Verify compares the environment with the manifest of the last build, including the content
+// of every file, paths in managed are maintained outside the builder and are not reported
+func (b *Builder) Verify(managed []string) (*VerifyResult, error) {
+	manifest, err := LoadManifest(b.manifest_path)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[string]bool{}
+	for _, path := range managed {
+		skip[filepath.Clean(path)] = true
+	}
+
+	result := &VerifyResult{}
+	seen := map[string]bool{}
+	err = filepath.WalkDir(b.root, func(target string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		path := strings.TrimPrefix(target, filepath.Clean(b.root))
+		if skip[path] {
+			return nil
+		}
+
+		expected, ok := manifest.Entries[path]
+		if !ok {
+			result.Added = append(result.Added, path)
+			return nil
+		}
+
+		seen[path] = true
+		if !matchesEntry(target, expected) {
+			result.Modified = append(result.Modified, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range manifest.Paths() {
+		if !seen[path] {
+			result.Deleted = append(result.Deleted, path)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Modified)
+	return result, nil
+}
+
+func matchesEntry(target string, expected ManifestEntry) bool {
+	info, err := os.Lstat(target)
+	if err != nil {
+		return false
+	}
+
+	if expected.Link != "" {
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return false
+		}
+		link, err := os.Readlink(target)
+		return err == nil && link == expected.Link
+	}
+
+	if !info.Mode().IsRegular() || info.Size() != expected.Size || info.Mode().Perm() != expected.Mode {
+		return false
+	}
+
+	hash, err := hashFile(target)
+	return err == nil && hash == expected.Hash
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
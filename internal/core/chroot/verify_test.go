@@ -0,0 +1,90 @@
+package chroot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	builder, source, root := newTestBuilder(t)
+	build(t, builder, source)
+
+	result, err := builder.Verify(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Intact() {
+		t.Fatalf("fresh build is not intact: %+v", result)
+	}
+
+	a := filepath.Join(source, "a.py")
+	b := filepath.Join(source, "pkg", "b.py")
+	pth := filepath.Join(source, "evil.pth")
+	managed := filepath.Join(source, "managed.txt")
+
+	// same size, different content
+	err = os.Chmod(filepath.Join(root, a), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, a), "x")
+	err = os.Chmod(filepath.Join(root, a), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(filepath.Join(root, b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, pth), "import os")
+	writeFile(t, filepath.Join(root, managed), "maintained elsewhere")
+
+	result, err = builder.Verify([]string{managed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &VerifyResult{Added: []string{pth}, Modified: []string{a}, Deleted: []string{b}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// a rebuild seeds a new environment without the modified files, they are copied from the host again
+	dir := t.TempDir()
+	rebuilt := NewBuilder(filepath.Join(dir, "root"), filepath.Join(dir, "manifest.json"))
+	err = rebuilt.Seed(root, builder.manifest_path, result.Modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build(t, rebuilt, source)
+
+	result, err = rebuilt.Verify(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Intact() {
+		t.Fatalf("rebuilt environment is not intact: %+v", result)
+	}
+}
+
+func TestVerifyMode(t *testing.T) {
+	builder, source, root := newTestBuilder(t)
+	build(t, builder, source)
+
+	a := filepath.Join(source, "a.py")
+	err := os.Chmod(filepath.Join(root, a), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := builder.Verify(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Modified, []string{a}) {
+		t.Fatalf("changed mode was not detected: %+v", result)
+	}
+}
@@ -0,0 +1,333 @@
+package chroot
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+)
+
+const (
+	// ACTIVE_LINK points to the version new executions use
+	ACTIVE_LINK = "current"
+	// PREVIOUS_LINK points to the version which was active before, a rollback reactivates it
+	PREVIOUS_LINK = "previous"
+)
+
+// Versions keeps environments in numbered directories v<N> below root, each with its manifest
+// next to it, an execution keeps the version which was active when it started even if another
+// one is activated meanwhile
+//
+// the active and the previous version are kept, every other version is removed once no
+// execution uses it anymore, anything else found below root is left over from older layouts
+type Versions struct {
+	root string
+
+	lock     sync.Mutex
+	active   int
+	previous int
+	// refs counts the running executions per version
+	refs map[int]int
+	// building versions are neither active nor referenced yet, but must not be collected
+	building map[int]bool
+}
+
+func NewVersions(root string) *Versions {
+	return &Versions{
+		root:     root,
+		refs:     map[int]int{},
+		building: map[int]bool{},
+	}
+}
+
+// Load reads the active and the previous version persisted by an earlier process
+func (v *Versions) Load() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	var err error
+	v.active, err = v.readLink(ACTIVE_LINK)
+	if err != nil {
+		return err
+	}
+
+	v.previous, err = v.readLink(PREVIOUS_LINK)
+	return err
+}
+
+// Path returns the directory of a version, the root of its chroot
+func (v *Versions) Path(version int) string {
+	return filepath.Join(v.root, fmt.Sprintf("v%d", version))
+}
+
+// ManifestPath returns where the manifest of a version is kept, outside of its chroot
+func (v *Versions) ManifestPath(version int) string {
+	return v.Path(version) + ".manifest.json"
+}
+
+// Active returns the active and the previous version, 0 if there is none
+func (v *Versions) Active() (int, int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.active, v.previous
+}
+
+// Acquire returns the directory of the active version and keeps it until release is called
+func (v *Versions) Acquire() (string, func(), error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.active == 0 {
+		return "", nil, errors.New("no environment has been built yet")
+	}
+
+	version := v.active
+	v.refs[version]++
+
+	released := false
+	return v.Path(version), func() {
+		v.lock.Lock()
+		if released {
+			v.lock.Unlock()
+			return
+		}
+		released = true
+
+		v.refs[version]--
+		if v.refs[version] == 0 {
+			delete(v.refs, version)
+		}
+		v.lock.Unlock()
+
+		// removing a version takes a while, the execution is done already
+		go v.collect()
+	}, nil
+}
+
+// Create reserves the directory of a new version, it has to be activated or discarded
+func (v *Versions) Create() (int, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	versions, err := v.list()
+	if err != nil {
+		return 0, err
+	}
+
+	version := v.active
+	for _, existing := range versions {
+		if existing > version {
+			version = existing
+		}
+	}
+	for existing := range v.building {
+		if existing > version {
+			version = existing
+		}
+	}
+	version++
+
+	err = os.MkdirAll(v.Path(version), 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	v.building[version] = true
+	return version, nil
+}
+
+// Discard removes a version which was created but not activated
+func (v *Versions) Discard(version int) {
+	v.lock.Lock()
+	delete(v.building, version)
+	v.lock.Unlock()
+
+	v.remove(version)
+}
+
+// Activate switches new executions to a version, the active one becomes the previous version
+func (v *Versions) Activate(version int) error {
+	v.lock.Lock()
+	defer v.collect()
+	defer v.lock.Unlock()
+
+	previous := v.active
+	if previous == version {
+		previous = v.previous
+	}
+
+	err := v.switchTo(version, previous)
+	if err != nil {
+		return err
+	}
+
+	delete(v.building, version)
+	return nil
+}
+
+// Rollback reactivates the previous version, the active one becomes the previous version so a
+// second rollback undoes the first
+func (v *Versions) Rollback() (int, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.previous == 0 {
+		return 0, errors.New("there is no previous environment to roll back to")
+	}
+
+	if _, err := os.Stat(v.Path(v.previous)); err != nil {
+		return 0, err
+	}
+
+	version := v.previous
+	err := v.switchTo(version, v.active)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// switchTo persists the links before the versions are switched in memory, the caller holds the lock
+func (v *Versions) switchTo(active int, previous int) error {
+	if previous != 0 {
+		err := v.writeLink(PREVIOUS_LINK, previous)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := v.writeLink(ACTIVE_LINK, active)
+	if err != nil {
+		return err
+	}
+
+	v.active = active
+	v.previous = previous
+	return nil
+}
+
+// collect removes everything below root which is not a version in use, the directory is read
+// under the lock so a version created meanwhile is not mistaken for an unused one
+func (v *Versions) collect() {
+	v.lock.Lock()
+	keep := map[string]bool{ACTIVE_LINK: true, PREVIOUS_LINK: true}
+	for _, version := range []int{v.active, v.previous} {
+		keep[filepath.Base(v.Path(version))] = true
+	}
+	for version := range v.refs {
+		keep[filepath.Base(v.Path(version))] = true
+	}
+	for version := range v.building {
+		keep[filepath.Base(v.Path(version))] = true
+	}
+
+	entries, err := os.ReadDir(v.root)
+	v.lock.Unlock()
+	if err != nil {
+		log.Warn("failed to read %s: %v", v.root, err)
+		return
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".manifest.json")
+		if keep[name] {
+			continue
+		}
+
+		err := os.RemoveAll(filepath.Join(v.root, entry.Name()))
+		if err != nil {
+			log.Warn("failed to remove unused environment %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+func (v *Versions) remove(version int) {
+	err := os.RemoveAll(v.Path(version))
+	if err != nil {
+		log.Warn("failed to remove environment v%d: %v", version, err)
+	}
+
+	err = os.Remove(v.ManifestPath(version))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn("failed to remove manifest of environment v%d: %v", version, err)
+	}
+}
+
+// list returns the versions found below root
+func (v *Versions) list() ([]int, error) {
+	entries, err := os.ReadDir(v.root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []int{}
+	for _, entry := range entries {
+		if version, ok := parseVersion(entry.Name()); ok && entry.IsDir() {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, nil
+}
+
+func (v *Versions) readLink(name string) (int, error) {
+	link, err := os.Readlink(filepath.Join(v.root, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	version, ok := parseVersion(link)
+	if !ok {
+		return 0, fmt.Errorf("%s points to %s which is no environment version", name, link)
+	}
+
+	return version, nil
+}
+
+// writeLink replaces a link atomically, its target is relative so it resolves the same from everywhere
+func (v *Versions) writeLink(name string, version int) error {
+	link := filepath.Join(v.root, name)
+	tmp_link := link + ".tmp"
+
+	os.Remove(tmp_link)
+	err := os.Symlink(filepath.Base(v.Path(version)), tmp_link)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp_link, link)
+	if err != nil {
+		os.Remove(tmp_link)
+		return err
+	}
+
+	return nil
+}
+
+func parseVersion(name string) (int, bool) {
+	number, ok := strings.CutPrefix(name, "v")
+	if !ok {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(number)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
+}
@@ -0,0 +1,164 @@
+package chroot
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createVersion(t *testing.T, versions *Versions) int {
+	t.Helper()
+
+	version, err := versions.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, versions.ManifestPath(version), "{}")
+	return version
+}
+
+func activate(t *testing.T, versions *Versions, version int) {
+	t.Helper()
+
+	err := versions.Activate(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+func TestVersionsActivate(t *testing.T) {
+	versions := NewVersions(t.TempDir())
+
+	_, _, err := versions.Acquire()
+	if err == nil {
+		t.Fatal("acquired an environment before any was built")
+	}
+
+	v1 := createVersion(t, versions)
+	activate(t, versions, v1)
+	v2 := createVersion(t, versions)
+	if v2 != v1+1 {
+		t.Fatalf("unexpected version %d after %d", v2, v1)
+	}
+	activate(t, versions, v2)
+
+	if active, previous := versions.Active(); active != v2 || previous != v1 {
+		t.Fatalf("unexpected versions %d, %d", active, previous)
+	}
+
+	// the links survive a restart
+	loaded := NewVersions(versions.root)
+	err = loaded.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, previous := loaded.Active(); active != v2 || previous != v1 {
+		t.Fatalf("unexpected versions after loading %d, %d", active, previous)
+	}
+}
+
+func TestVersionsCollect(t *testing.T) {
+	versions := NewVersions(t.TempDir())
+	v1 := createVersion(t, versions)
+	activate(t, versions, v1)
+
+	// an execution keeps its version
+	path, release, err := versions.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != versions.Path(v1) {
+		t.Fatalf("unexpected path %s", path)
+	}
+
+	leftover := filepath.Join(versions.root, "python-packages")
+	writeFile(t, leftover, "from an older layout")
+
+	// a version being built is neither active nor referenced
+	v2 := createVersion(t, versions)
+	versions.collect()
+	if !exists(versions.Path(v2)) {
+		t.Fatal("version being built was collected")
+	}
+	if exists(leftover) {
+		t.Error("leftover of an older layout was not collected")
+	}
+
+	activate(t, versions, v2)
+	v3 := createVersion(t, versions)
+	activate(t, versions, v3)
+
+	// v1 is neither active nor previous, but still in use
+	if !exists(versions.Path(v1)) || !exists(versions.ManifestPath(v1)) {
+		t.Fatal("version in use was collected")
+	}
+
+	release()
+	// releasing twice must not drop a reference of another execution
+	release()
+	versions.collect()
+
+	if exists(versions.Path(v1)) || exists(versions.ManifestPath(v1)) {
+		t.Error("unused version was not collected")
+	}
+	for _, version := range []int{v2, v3} {
+		if !exists(versions.Path(version)) {
+			t.Errorf("version %d was collected", version)
+		}
+	}
+}
+
+func TestVersionsRollback(t *testing.T) {
+	versions := NewVersions(t.TempDir())
+
+	_, err := versions.Rollback()
+	if err == nil {
+		t.Fatal("rolled back without a previous version")
+	}
+
+	v1 := createVersion(t, versions)
+	activate(t, versions, v1)
+	v2 := createVersion(t, versions)
+	activate(t, versions, v2)
+
+	version, err := versions.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, previous := versions.Active(); version != v1 || active != v1 || previous != v2 {
+		t.Fatalf("unexpected versions after rollback %d, %d, %d", version, active, previous)
+	}
+
+	// a second rollback undoes the first
+	version, err = versions.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, previous := versions.Active(); version != v2 || active != v2 || previous != v1 {
+		t.Fatalf("unexpected versions after the second rollback %d, %d, %d", version, active, previous)
+	}
+}
+
+func TestVersionsDiscard(t *testing.T) {
+	versions := NewVersions(t.TempDir())
+	v1 := createVersion(t, versions)
+	activate(t, versions, v1)
+
+	v2 := createVersion(t, versions)
+	versions.Discard(v2)
+	if exists(versions.Path(v2)) || exists(versions.ManifestPath(v2)) {
+		t.Fatal("discarded version was left behind")
+	}
+
+	if active, _ := versions.Active(); active != v1 {
+		t.Fatalf("discarding changed the active version to %d", active)
+	}
+}
@@ -0,0 +1,275 @@
+package jobs
+
+/*
+	jobs module runs changes of the sandbox in the background, one after another, and keeps their
+	state and output in memory, so a client can follow them after its request has returned
+*/
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+)
+
+const (
+	STATUS_PENDING   = "pending"
+	STATUS_RUNNING   = "running"
+	STATUS_SUCCEEDED = "succeeded"
+	STATUS_FAILED    = "failed"
+
+	// MAX_JOBS finished jobs are kept, older ones are forgotten
+	MAX_JOBS = 100
+	// MAX_LOG_SIZE caps the output kept per job, the beginning is dropped once it is exceeded
+	MAX_LOG_SIZE = 1024 * 1024
+)
+
+// Job is a change running in the background, its fields are only accessed through its methods
+type Job struct {
+	lock sync.Mutex
+
+	id         string
+	kind       string
+	language   string
+	profile    string
+	status     string
+	err        string
+	created_at time.Time
+	started_at time.Time
+	ended_at   time.Time
+	logs       []byte
+	truncated  bool
+	changes    []types.VersionChange
+
+	run  func(job *Job) error
+	done chan struct{}
+}
+
+// Snapshot is the state of a job at one point in time
+type Snapshot struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Language string `json:"language"`
+	// Profile is the dependency profile the job changes, empty if it changes every profile
+	Profile string `json:"profile,omitempty"`
+	Status  string `json:"status"`
+	// Error is set if the job failed
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// Changes are the packages whose versions the job changed
+	Changes []types.VersionChange `json:"changes,omitempty"`
+	// Logs is only set when a single job is requested
+	Logs string `json:"logs,omitempty"`
+}
+
+var (
+	jobs      = map[string]*Job{}
+	order     = []*Job{}
+	jobs_lock sync.Mutex
+
+	queue      = make(chan *Job, MAX_JOBS)
+	queue_once sync.Once
+)
+
+// Submit queues a job, jobs run one after another in the order they were submitted
+func Submit(kind string, language string, profile string, run func(job *Job) error) (*Job, error) {
+	queue_once.Do(func() {
+		go worker()
+	})
+
+	job := &Job{
+		id:         uuid.NewString(),
+		kind:       kind,
+		language:   language,
+		profile:    profile,
+		status:     STATUS_PENDING,
+		created_at: time.Now(),
+		run:        run,
+		done:       make(chan struct{}),
+	}
+
+	jobs_lock.Lock()
+	defer jobs_lock.Unlock()
+
+	select {
+	case queue <- job:
+	default:
+		return nil, fmt.Errorf("too many pending jobs, try again later")
+	}
+
+	jobs[job.id] = job
+	order = append(order, job)
+	forget()
+
+	return job, nil
+}
+
+// Get returns a job by its id
+func Get(id string) (*Job, bool) {
+	jobs_lock.Lock()
+	defer jobs_lock.Unlock()
+
+	job, ok := jobs[id]
+	return job, ok
+}
+
+// List returns the state of the jobs which are kept, the latest first, without their logs
+func List() []Snapshot {
+	jobs_lock.Lock()
+	defer jobs_lock.Unlock()
+
+	snapshots := make([]Snapshot, 0, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		snapshots = append(snapshots, order[i].Snapshot(false))
+	}
+
+	return snapshots
+}
+
+// forget removes the oldest finished jobs beyond MAX_JOBS, the caller holds jobs_lock
+func forget() {
+	for len(order) > MAX_JOBS {
+		job := order[0]
+		if !job.Done() {
+			return
+		}
+
+		delete(jobs, job.id)
+		order = order[1:]
+	}
+}
+
+func worker() {
+	for job := range queue {
+		job.start()
+
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("job panicked: %v", r)
+				}
+			}()
+			return job.run(job)
+		}()
+
+		job.finish(err)
+	}
+}
+
+func (j *Job) start() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.status = STATUS_RUNNING
+	j.started_at = time.Now()
+	log.Info("job %s %s of %s started", j.id, j.kind, j.subject())
+}
+
+func (j *Job) finish(err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	defer close(j.done)
+
+	j.ended_at = time.Now()
+	j.run = nil
+	if err != nil {
+		j.status = STATUS_FAILED
+		j.err = err.Error()
+		log.Error("job %s %s of %s failed: %v", j.id, j.kind, j.subject(), err)
+		return
+	}
+
+	j.status = STATUS_SUCCEEDED
+	log.Info("job %s %s of %s succeeded", j.id, j.kind, j.subject())
+}
+
+// subject names what the job changes in its log messages
+func (j *Job) subject() string {
+	if j.profile == "" {
+		return j.language
+	}
+	return j.language + " profile " + j.profile
+}
+
+// Write appends output of the job to its logs
+func (j *Job) Write(p []byte) (int, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.logs = append(j.logs, p...)
+	if len(j.logs) > MAX_LOG_SIZE {
+		j.logs = j.logs[len(j.logs)-MAX_LOG_SIZE:]
+		j.truncated = true
+	}
+
+	return len(p), nil
+}
+
+// Logf appends a line to the logs of the job
+func (j *Job) Logf(format string, args ...any) {
+	fmt.Fprintf(j, format+"\n", args...)
+}
+
+// AddChanges records packages whose versions the job changed
+func (j *Job) AddChanges(changes ...types.VersionChange) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.changes = append(j.changes, changes...)
+}
+
+func (j *Job) ID() string {
+	return j.id
+}
+
+// Done reports whether the job has finished, successfully or not
+func (j *Job) Done() bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.status == STATUS_SUCCEEDED || j.status == STATUS_FAILED
+}
+
+// Wait blocks until the job has finished
+func (j *Job) Wait() {
+	<-j.done
+}
+
+// Snapshot returns the state of the job, with its logs if logs is set
+func (j *Job) Snapshot(logs bool) Snapshot {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	snapshot := Snapshot{
+		ID:        j.id,
+		Kind:      j.kind,
+		Language:  j.language,
+		Profile:   j.profile,
+		Status:    j.status,
+		Error:     j.err,
+		CreatedAt: j.created_at,
+		Changes:   append([]types.VersionChange{}, j.changes...),
+	}
+	if !j.started_at.IsZero() {
+		started_at := j.started_at
+		snapshot.StartedAt = &started_at
+	}
+	if !j.ended_at.IsZero() {
+		ended_at := j.ended_at
+		snapshot.EndedAt = &ended_at
+	}
+
+	if logs {
+		if j.truncated {
+			snapshot.Logs = "[earlier output was truncated]\n"
+		}
+		snapshot.Logs += string(j.logs)
+	}
+
+	return snapshot
+}
@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func submit(t *testing.T, run func(job *Job) error) *Job {
+	t.Helper()
+
+	job, err := Submit("test", "python3", "", run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return job
+}
+
+func TestJob(t *testing.T) {
+	job := submit(t, func(job *Job) error {
+		job.Logf("step %d", 1)
+		return nil
+	})
+	job.Wait()
+
+	snapshot := job.Snapshot(true)
+	if snapshot.Status != STATUS_SUCCEEDED || snapshot.Logs != "step 1\n" || snapshot.StartedAt == nil || snapshot.EndedAt == nil {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+	if job.Snapshot(false).Logs != "" {
+		t.Error("logs are part of a snapshot without logs")
+	}
+
+	if found, ok := Get(job.ID()); !ok || found != job {
+		t.Error("job was not found by its id")
+	}
+
+	failed := submit(t, func(job *Job) error {
+		return errors.New("broken")
+	})
+	panicked := submit(t, func(job *Job) error {
+		panic("broken")
+	})
+	panicked.Wait()
+
+	// jobs run in the order they were submitted
+	if !failed.Done() {
+		t.Fatal("job submitted earlier has not finished")
+	}
+	if snapshot := failed.Snapshot(false); snapshot.Status != STATUS_FAILED || snapshot.Error != "broken" {
+		t.Errorf("unexpected snapshot of a failed job %+v", snapshot)
+	}
+	if snapshot := panicked.Snapshot(false); snapshot.Status != STATUS_FAILED || !strings.Contains(snapshot.Error, "panicked") {
+		t.Errorf("unexpected snapshot of a panicked job %+v", snapshot)
+	}
+}
+
+func TestJobLogsTruncated(t *testing.T) {
+	job := submit(t, func(job *Job) error {
+		job.Write([]byte(strings.Repeat("a", MAX_LOG_SIZE)))
+		job.Write([]byte("end"))
+		return nil
+	})
+	job.Wait()
+
+	logs := job.Snapshot(true).Logs
+	if !strings.HasPrefix(logs, "[earlier output was truncated]\n") || !strings.HasSuffix(logs, "aend") {
+		t.Fatalf("unexpected logs %q...", logs[:40])
+	}
+	if len(logs) != len("[earlier output was truncated]\n")+MAX_LOG_SIZE {
+		t.Errorf("unexpected size of the logs %d", len(logs))
+	}
+}
+
+func TestForget(t *testing.T) {
+	first := submit(t, func(job *Job) error { return nil })
+	first.Wait()
+
+	submitted := []*Job{}
+	for i := 0; i < MAX_JOBS; i++ {
+		job := submit(t, func(job *Job) error { return nil })
+		job.Wait()
+		submitted = append(submitted, job)
+	}
+
+	if _, ok := Get(first.ID()); ok {
+		t.Error("oldest finished job was kept beyond MAX_JOBS")
+	}
+
+	list := List()
+	if len(list) != MAX_JOBS {
+		t.Fatalf("%d jobs are kept, expected %d", len(list), MAX_JOBS)
+	}
+	// the latest first
+	if list[0].ID != submitted[len(submitted)-1].ID() || list[len(list)-1].ID != submitted[0].ID() {
+		t.Error("jobs are not listed from the latest")
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	blocking := submit(t, func(job *Job) error {
+		close(started)
+		<-unblock
+		return nil
+	})
+	<-started
+
+	// the running job has left the queue, every other one waits in it
+	pending := []*Job{}
+	for i := 0; i < MAX_JOBS; i++ {
+		pending = append(pending, submit(t, func(job *Job) error { return nil }))
+	}
+
+	_, err := Submit("test", "python3", "", func(job *Job) error { return nil })
+	if err == nil {
+		t.Fatal("job was queued beyond MAX_JOBS")
+	}
+
+	// unfinished jobs are never forgotten
+	if _, ok := Get(blocking.ID()); !ok {
+		t.Error("running job was forgotten")
+	}
+	if len(List()) != MAX_JOBS+1 {
+		t.Errorf("%d jobs are kept, expected %d", len(List()), MAX_JOBS+1)
+	}
+
+	close(unblock)
+	for _, job := range pending {
+		job.Wait()
+	}
+	if snapshot := pending[0].Snapshot(false); snapshot.Status != STATUS_SUCCEEDED {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+}
@@ -0,0 +1,157 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ENV_LANDLOCK_READ_PATHS lists the paths which stay readable and executable, separated by ':'
+	ENV_LANDLOCK_READ_PATHS = "LANDLOCK_READ_PATHS"
+	// ENV_LANDLOCK_WRITE_PATHS lists the paths which stay readable and writable, separated by ':'
+	ENV_LANDLOCK_WRITE_PATHS = "LANDLOCK_WRITE_PATHS"
+)
+
+const (
+	LANDLOCK_ACCESS_FS_IOCTL_DEV = 0x8000
+
+	LANDLOCK_ACCESS_FS_READ = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR
+
+	// rights which can be granted on a file, the others only apply to the content of directories
+	LANDLOCK_ACCESS_FS_FILE = unix.LANDLOCK_ACCESS_FS_EXECUTE |
+		unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE |
+		LANDLOCK_ACCESS_FS_IOCTL_DEV
+)
+
+// LandlockABI returns the landlock version of the kernel, 0 if landlock is not supported or disabled
+func LandlockABI() int {
+	abi, _, errno := syscall.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET,
+		0,
+		0,
+		unix.LANDLOCK_CREATE_RULESET_VERSION,
+	)
+	if errno != 0 {
+		return 0
+	}
+
+	return int(abi)
+}
+
+// landlockHandledAccess returns every filesystem right known to the abi,
+// rights which are not handled stay allowed
+func landlockHandledAccess(abi int) uint64 {
+	// the rights of the first version are the bits up to MAKE_SYM
+	access := uint64(unix.LANDLOCK_ACCESS_FS_MAKE_SYM<<1 - 1)
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	if abi >= 5 {
+		access |= LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+
+	return access
+}
+
+// SetupLandlock confines the filesystem to the paths of ENV_LANDLOCK_READ_PATHS and
+// ENV_LANDLOCK_WRITE_PATHS as a second layer behind chroot, paths are resolved in the
+// current root so it must be called after chroot and before seccomp forbids the landlock syscalls
+//
+// it's a no-op if the runner passed no paths or the kernel does not support landlock,
+// the runner warns about the latter once at startup
+func SetupLandlock() error {
+	read_paths := filepath.SplitList(os.Getenv(ENV_LANDLOCK_READ_PATHS))
+	write_paths := filepath.SplitList(os.Getenv(ENV_LANDLOCK_WRITE_PATHS))
+	if len(read_paths) == 0 && len(write_paths) == 0 {
+		return nil
+	}
+
+	abi := LandlockABI()
+	if abi == 0 {
+		return nil
+	}
+
+	handled := landlockHandledAccess(abi)
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	ruleset, _, errno := syscall.Syscall(
+		unix.SYS_LANDLOCK_CREATE_RULESET,
+		uintptr(unsafe.Pointer(&attr)),
+		unsafe.Sizeof(attr),
+		0,
+	)
+	if errno != 0 {
+		return errno
+	}
+	defer syscall.Close(int(ruleset))
+
+	for _, path := range read_paths {
+		err := addLandlockRule(int(ruleset), path, LANDLOCK_ACCESS_FS_READ&handled)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, path := range write_paths {
+		err := addLandlockRule(int(ruleset), path, handled)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, _, errno = syscall.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, ruleset, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// addLandlockRule allows access beneath path, paths which are missing in the root are skipped
+func addLandlockRule(ruleset int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			return nil
+		}
+		return err
+	}
+	defer unix.Close(fd)
+
+	var stat unix.Stat_t
+	err = unix.Fstat(fd, &stat)
+	if err != nil {
+		return err
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= LANDLOCK_ACCESS_FS_FILE
+	}
+
+	rule := unix.LandlockPathBeneathAttr{
+		Allowed_access: access,
+		Parent_fd:      int32(fd),
+	}
+	_, _, errno := syscall.Syscall6(
+		unix.SYS_LANDLOCK_ADD_RULE,
+		uintptr(ruleset),
+		unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&rule)),
+		0, 0, 0,
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
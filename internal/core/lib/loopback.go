@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type ifreqFlags struct {
+	Name  [syscall.IFNAMSIZ]byte
+	Flags uint16
+	_     [22]byte
+}
+
+// SetupLoopback brings up the loopback interface, a fresh network namespace only
+// contains a `lo` device which is down by default
+func SetupLoopback() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	req := ifreqFlags{}
+	copy(req.Name[:], "lo")
+
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&req)))
+	if e != 0 {
+		return e
+	}
+
+	if req.Flags&syscall.IFF_UP != 0 {
+		return nil
+	}
+
+	req.Flags |= syscall.IFF_UP | syscall.IFF_RUNNING
+	_, _, e = syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req)))
+	if e != 0 {
+		return e
+	}
+
+	return nil
+}
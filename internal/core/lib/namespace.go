@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	SANDBOX_HOSTNAME = "sandbox"
+
+	// ENV_SCRATCH_PATH is the host path of the scratch directory the runner mounted for the execution
+	ENV_SCRATCH_PATH = "SANDBOX_SCRATCH_PATH"
+	// ENV_SCRATCH_SIZE is the size cap in bytes of the tmpfs mounted by the process itself if
+	// the runner could not mount one, as in rootless mode
+	ENV_SCRATCH_SIZE = "SANDBOX_SCRATCH_SIZE"
+
+	DEFAULT_SCRATCH_SIZE = 64 << 20
+
+	// ENV_READONLY_MOUNTS lists host directories and files mounted read only into the new root,
+	// as host_path=sandbox_path pairs separated by :
+	ENV_READONLY_MOUNTS = "SANDBOX_READONLY_MOUNTS"
+
+	// SCRATCH_MOUNT_PATH is where the scratch directory appears inside the chroot, it's also the working directory
+	SCRATCH_MOUNT_PATH = "/tmp"
+)
+
+// SetupNamespaces prepares the mount and uts namespaces the runner spawned us in,
+// it mounts a private /proc, the scratch directory as /tmp and the read only mounts into the
+// current directory which is about to become the new root
+//
+// it's a no-op if the process is not the init process of a pid namespace,
+// as mounting in the initial mount namespace would leak to the host
+func SetupNamespaces() error {
+	if os.Getpid() != 1 {
+		return nil
+	}
+
+	// stop mount events from propagating back to the host
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll("proc", 0555)
+	if err != nil {
+		return err
+	}
+	err = syscall.Mount("proc", "proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	if err != nil {
+		return err
+	}
+
+	err = setupScratch()
+	if err != nil {
+		return err
+	}
+
+	err = setupReadonlyMounts()
+	if err != nil {
+		return err
+	}
+
+	return syscall.Sethostname([]byte(SANDBOX_HOSTNAME))
+}
+
+// setupScratch mounts the scratch directory of the execution as tmp
+func setupScratch() error {
+	err := os.MkdirAll("tmp", 01777)
+	if err != nil {
+		return err
+	}
+
+	scratch_path := os.Getenv(ENV_SCRATCH_PATH)
+	if scratch_path != "" {
+		err = syscall.Mount(scratch_path, "tmp", "", syscall.MS_BIND, "")
+		if err != nil {
+			return err
+		}
+
+		// flags of a bind mount can only be changed by remounting it
+		return syscall.Mount(
+			"", "tmp", "",
+			syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_NOSUID|syscall.MS_NODEV,
+			"",
+		)
+	}
+
+	size := DEFAULT_SCRATCH_SIZE
+	if size_str := os.Getenv(ENV_SCRATCH_SIZE); size_str != "" {
+		size, err = strconv.Atoi(size_str)
+		if err != nil {
+			return err
+		}
+	}
+
+	return syscall.Mount(
+		"tmpfs", "tmp", "tmpfs",
+		syscall.MS_NOSUID|syscall.MS_NODEV,
+		fmt.Sprintf("size=%d,mode=1777", size),
+	)
+}
+
+// setupReadonlyMounts bind mounts the directories and files of ENV_READONLY_MOUNTS, they are
+// shared with the host and other executions instead of being copied for every execution
+func setupReadonlyMounts() error {
+	mounts := os.Getenv(ENV_READONLY_MOUNTS)
+	if mounts == "" {
+		return nil
+	}
+
+	for _, mount := range strings.Split(mounts, ":") {
+		host_path, sandbox_path, ok := strings.Cut(mount, "=")
+		if !ok {
+			return fmt.Errorf("invalid read only mount %s", mount)
+		}
+
+		target := strings.TrimPrefix(sandbox_path, "/")
+		err := createMountTarget(host_path, target)
+		if err != nil {
+			return err
+		}
+
+		err = syscall.Mount(host_path, target, "", syscall.MS_BIND|syscall.MS_REC, "")
+		if err != nil {
+			return err
+		}
+
+		err = syscall.Mount(
+			"", target, "",
+			syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV,
+			"",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createMountTarget creates what a host path is mounted onto, a file can only be mounted onto a file
+func createMountTarget(host_path string, target string) error {
+	info, err := os.Stat(host_path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+
+	err = os.MkdirAll(path.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_RDONLY, 0444)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -8,22 +8,82 @@ import (
 
 	"github.com/langgenius/dify-sandbox/internal/core/lib"
 	"github.com/langgenius/dify-sandbox/internal/static/nodejs_syscall"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
 )
 
 //var allow_syscalls = []int{}
 
 func InitSeccomp(uid int, gid int, enable_network bool) error {
-	err := syscall.Chroot(".")
+	if !enable_network {
+		// the process is running in a fresh network namespace, only loopback is available
+		err := lib.SetupLoopback()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := lib.SetupNamespaces()
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Chroot(".")
 	if err != nil {
 		return err
 	}
-	err = syscall.Chdir("/")
+	// untrusted code works in the scratch directory, the only writable one
+	err = syscall.Chdir(lib.SCRATCH_MOUNT_PATH)
 	if err != nil {
 		return err
 	}
 
 	lib.SetNoNewPrivs()
 
+	// restrict the filesystem again in case the chroot is escaped or exposes too much
+	err = lib.SetupLandlock()
+	if err != nil {
+		return err
+	}
+
+	// privileges are dropped before the filter, so it does not need to allow setuid and friends
+	err = lib.DropPrivileges(uid, gid)
+	if err != nil {
+		return err
+	}
+
+	err = lib.SetupSyscallReport()
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv(seccomp_profile.ENV_SECCOMP_LEARN) != "" {
+		err = lib.SeccompLearn()
+	} else {
+		err = loadSeccompProfile(enable_network)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// loadSeccompProfile loads the profile passed by the runner, or the built-in syscall tables
+func loadSeccompProfile(enable_network bool) error {
+	profile, err := seccomp_profile.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	if profile != nil {
+		return lib.SeccompProfile(profile, enable_network)
+	}
+
+	return seccompFromSyscallTables(enable_network)
+}
+
+// seccompFromSyscallTables loads the built-in syscall tables, or the raw numbers of ALLOWED_SYSCALLS
+func seccompFromSyscallTables(enable_network bool) error {
 	allowed_syscalls := []int{}
 	allowed_not_kill_syscalls := []int{}
 
@@ -46,22 +106,5 @@ func InitSeccomp(uid int, gid int, enable_network bool) error {
 		}
 	}
 
-	err = lib.Seccomp(allowed_syscalls, allowed_not_kill_syscalls)
-	if err != nil {
-		return err
-	}
-
-	// setuid
-	err = syscall.Setuid(uid)
-	if err != nil {
-		return err
-	}
-
-	// setgid
-	err = syscall.Setgid(gid)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return lib.Seccomp(allowed_syscalls, allowed_not_kill_syscalls)
 }
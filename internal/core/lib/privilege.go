@@ -0,0 +1,309 @@
+package lib
+
+/*
+#define _GNU_SOURCE
+#include <dirent.h>
+#include <errno.h>
+#include <signal.h>
+#include <stdlib.h>
+#include <string.h>
+#include <time.h>
+#include <unistd.h>
+#include <sys/prctl.h>
+#include <sys/syscall.h>
+#include <linux/capability.h>
+
+#ifndef PR_CAP_AMBIENT
+#define PR_CAP_AMBIENT 47
+#define PR_CAP_AMBIENT_CLEAR_ALL 4
+#endif
+
+#define DROP_BOUNDING_SET 1
+#define DROP_CAPABILITIES 2
+
+static int drop_op = 0;
+static int drop_pending = 0;
+static int drop_failed = 0;
+
+static int drop_thread(int op) {
+	if (op == DROP_BOUNDING_SET) {
+		int capability;
+		for (capability = 0; prctl(PR_CAPBSET_READ, capability, 0, 0, 0) >= 0; capability++) {
+			if (prctl(PR_CAPBSET_DROP, capability, 0, 0, 0) != 0) {
+				return -1;
+			}
+		}
+		return 0;
+	}
+
+	// EINVAL means the kernel has no ambient capabilities
+	if (prctl(PR_CAP_AMBIENT, PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0) != 0 && errno != EINVAL) {
+		return -1;
+	}
+
+	struct __user_cap_header_struct header;
+	struct __user_cap_data_struct data[2];
+	memset(&header, 0, sizeof(header));
+	memset(data, 0, sizeof(data));
+	header.version = _LINUX_CAPABILITY_VERSION_3;
+	return syscall(SYS_capset, &header, data) == 0 ? 0 : -1;
+}
+
+static void drop_handler(int sig) {
+	int saved_errno = errno;
+	if (drop_thread(__atomic_load_n(&drop_op, __ATOMIC_SEQ_CST)) != 0) {
+		__atomic_store_n(&drop_failed, 1, __ATOMIC_SEQ_CST);
+	}
+	__atomic_sub_fetch(&drop_pending, 1, __ATOMIC_SEQ_CST);
+	errno = saved_errno;
+}
+
+static int drop_seen(pid_t *tids, int n, pid_t tid) {
+	int i;
+	for (i = 0; i < n; i++) {
+		if (tids[i] == tid) {
+			return 1;
+		}
+	}
+	return 0;
+}
+
+// signals every other thread to drop as well and waits for them, the threads are listed again
+// until no new one shows up as a thread spawned by one which has not dropped yet inherits its set
+static int drop_all_threads(int op) {
+	pid_t pid = getpid();
+	pid_t self = syscall(SYS_gettid);
+	pid_t tids[4096];
+	int seen = 0;
+	int signaled = 1;
+	int waited;
+
+	struct sigaction action, previous;
+	memset(&action, 0, sizeof(action));
+	action.sa_handler = drop_handler;
+	action.sa_flags = SA_RESTART;
+	sigfillset(&action.sa_mask);
+	if (sigaction(SIGRTMIN, &action, &previous) != 0) {
+		return -1;
+	}
+
+	__atomic_store_n(&drop_op, op, __ATOMIC_SEQ_CST);
+	__atomic_store_n(&drop_failed, 0, __ATOMIC_SEQ_CST);
+
+	if (drop_thread(op) != 0) {
+		__atomic_store_n(&drop_failed, 1, __ATOMIC_SEQ_CST);
+	}
+
+	while (signaled > 0 && !__atomic_load_n(&drop_failed, __ATOMIC_SEQ_CST)) {
+		signaled = 0;
+
+		DIR *dir = opendir("/proc/self/task");
+		if (dir == NULL) {
+			__atomic_store_n(&drop_failed, 1, __ATOMIC_SEQ_CST);
+			break;
+		}
+
+		struct dirent *entry;
+		while ((entry = readdir(dir)) != NULL) {
+			pid_t tid = atoi(entry->d_name);
+			if (tid <= 0 || tid == self || drop_seen(tids, seen, tid)) {
+				continue;
+			}
+			if (seen == (int)(sizeof(tids) / sizeof(tids[0]))) {
+				__atomic_store_n(&drop_failed, 1, __ATOMIC_SEQ_CST);
+				break;
+			}
+			tids[seen++] = tid;
+
+			__atomic_add_fetch(&drop_pending, 1, __ATOMIC_SEQ_CST);
+			if (syscall(SYS_tgkill, pid, tid, SIGRTMIN) != 0) {
+				// the thread has exited in the meantime
+				__atomic_sub_fetch(&drop_pending, 1, __ATOMIC_SEQ_CST);
+				continue;
+			}
+			signaled++;
+		}
+		closedir(dir);
+
+		// a thread blocking the signal never drops, give up after a second
+		struct timespec delay = {0, 1000000};
+		for (waited = 0; __atomic_load_n(&drop_pending, __ATOMIC_SEQ_CST) > 0 && waited < 1000; waited++) {
+			nanosleep(&delay, NULL);
+		}
+		if (__atomic_load_n(&drop_pending, __ATOMIC_SEQ_CST) > 0) {
+			__atomic_store_n(&drop_failed, 1, __ATOMIC_SEQ_CST);
+		}
+	}
+
+	sigaction(SIGRTMIN, &previous, NULL);
+	return __atomic_load_n(&drop_failed, __ATOMIC_SEQ_CST) ? -1 : 0;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DropPrivileges switches the process to uid and gid without any supplementary group or
+// capability left, and verifies the result as running untrusted code with leftovers of root
+// is worse than not running it at all
+//
+// capabilities belong to a thread, the runtime has spawned threads of its own by now so the
+// bounding set and the capabilities are dropped on every thread of the process, setuid and
+// setgid already apply to all of them
+func DropPrivileges(uid int, gid int) error {
+	err := clearSupplementaryGroups()
+	if err != nil {
+		return err
+	}
+
+	// the bounding set can only be changed with CAP_SETPCAP, drop it while we are still root
+	err = clearBoundingSet()
+	if err != nil {
+		return err
+	}
+
+	// setgid first, it's not permitted anymore once root is dropped
+	err = syscall.Setgid(gid)
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Setuid(uid)
+	if err != nil {
+		return err
+	}
+
+	err = clearCapabilities()
+	if err != nil {
+		return err
+	}
+
+	return verifyPrivileges(uid, gid)
+}
+
+// clearSupplementaryGroups drops the groups inherited from root, the user namespace of
+// rootless mode denies setgroups, only the unprivileged server user is mapped there anyway
+func clearSupplementaryGroups() error {
+	err := syscall.Setgroups([]int{})
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, syscall.EPERM) && setgroupsDenied() {
+		return nil
+	}
+
+	return fmt.Errorf("failed to clear supplementary groups: %v", err)
+}
+
+func setgroupsDenied() bool {
+	content, err := os.ReadFile("/proc/self/setgroups")
+	return err == nil && strings.TrimSpace(string(content)) == "deny"
+}
+
+func clearBoundingSet() error {
+	if C.drop_all_threads(C.DROP_BOUNDING_SET) != 0 {
+		return errors.New("failed to drop the capability bounding set of every thread")
+	}
+
+	return nil
+}
+
+// clearCapabilities empties the ambient, effective, permitted and inheritable sets,
+// root keeps its capabilities across setuid(0) in rootless mode
+func clearCapabilities() error {
+	if C.drop_all_threads(C.DROP_CAPABILITIES) != 0 {
+		return errors.New("failed to clear the capabilities of every thread")
+	}
+
+	return nil
+}
+
+// verifyPrivileges reads the status of every thread, one left with root or a capability would
+// hand them to untrusted code running on it
+func verifyPrivileges(uid int, gid int) error {
+	statuses, err := filepath.Glob("/proc/self/task/*/status")
+	if err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		return errors.New("failed to list the threads of the process")
+	}
+
+	check_groups := !setgroupsDenied()
+	for _, status := range statuses {
+		err := verifyThreadPrivileges(status, uid, gid, check_groups)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func verifyThreadPrivileges(status string, uid int, gid int, check_groups bool) error {
+	content, err := os.ReadFile(status)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// the thread has exited
+			return nil
+		}
+		return err
+	}
+
+	thread := filepath.Base(filepath.Dir(status))
+	expected := map[string]string{
+		"Uid":    strings.Repeat(strconv.Itoa(uid)+" ", 4),
+		"Gid":    strings.Repeat(strconv.Itoa(gid)+" ", 4),
+		"CapInh": "0",
+		"CapPrm": "0",
+		"CapEff": "0",
+		"CapBnd": "0",
+		"CapAmb": "0",
+	}
+	if check_groups {
+		expected["Groups"] = ""
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		want, ok := expected[name]
+		if !ok {
+			continue
+		}
+		delete(expected, name)
+
+		value = strings.Join(strings.Fields(value), " ")
+		if strings.HasPrefix(name, "Cap") {
+			bits, err := strconv.ParseUint(value, 16, 64)
+			if err != nil {
+				return fmt.Errorf("thread %s: invalid %s %s", thread, name, value)
+			}
+			value = strconv.FormatUint(bits, 10)
+		}
+
+		if value != strings.TrimSpace(want) {
+			return fmt.Errorf("thread %s: %s is %s after dropping privileges, expected %s", thread, name, value, strings.TrimSpace(want))
+		}
+	}
+
+	// CapAmb is missing on kernels without ambient capabilities
+	delete(expected, "CapAmb")
+	for name := range expected {
+		return fmt.Errorf("thread %s: %s is missing from %s", thread, name, status)
+	}
+
+	return nil
+}
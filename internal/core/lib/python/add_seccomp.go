@@ -8,59 +8,104 @@ import (
 
 	"github.com/langgenius/dify-sandbox/internal/core/lib"
 	"github.com/langgenius/dify-sandbox/internal/static/python_syscall"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
 )
 
 //var allow_syscalls = []int{}
 
 func InitSeccomp(uid int, gid int, enable_network bool) error {
-	err := syscall.Chroot(".")
+	if !enable_network {
+		// the process is running in a fresh network namespace, only loopback is available
+		err := lib.SetupLoopback()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := lib.SetupNamespaces()
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Chroot(".")
 	if err != nil {
 		return err
 	}
-	err = syscall.Chdir("/")
+	// untrusted code works in the scratch directory, the only writable one
+	err = syscall.Chdir(lib.SCRATCH_MOUNT_PATH)
 	if err != nil {
 		return err
 	}
 
 	lib.SetNoNewPrivs()
 
-	allowed_syscalls := []int{}
-	allowed_not_kill_syscalls := []int{}
-	allowed_not_kill_syscalls = append(allowed_not_kill_syscalls, python_syscall.ALLOW_ERROR_SYSCALLS...)
-
-	allowed_syscall := os.Getenv("ALLOWED_SYSCALLS")
-	if allowed_syscall != "" {
-		nums := strings.Split(allowed_syscall, ",")
-		for num := range nums {
-			syscall, err := strconv.Atoi(nums[num])
-			if err != nil {
-				continue
-			}
-			allowed_syscalls = append(allowed_syscalls, syscall)
-		}
-	} else {
-		allowed_syscalls = append(allowed_syscalls, python_syscall.ALLOW_SYSCALLS...)
-		if enable_network {
-			allowed_syscalls = append(allowed_syscalls, python_syscall.ALLOW_NETWORK_SYSCALLS...)
-		}
+	// restrict the filesystem again in case the chroot is escaped or exposes too much
+	err = lib.SetupLandlock()
+	if err != nil {
+		return err
 	}
 
-	err = lib.Seccomp(allowed_syscalls, allowed_not_kill_syscalls)
+	// privileges are dropped before the filter, so it does not need to allow setuid and friends
+	err = lib.DropPrivileges(uid, gid)
 	if err != nil {
 		return err
 	}
 
-	// setuid
-	err = syscall.Setuid(uid)
+	err = lib.SetupSyscallReport()
 	if err != nil {
 		return err
 	}
 
-	// setgid
-	err = syscall.Setgid(gid)
+	if os.Getenv(seccomp_profile.ENV_SECCOMP_LEARN) != "" {
+		err = lib.SeccompLearn()
+	} else {
+		err = loadSeccompProfile(enable_network)
+	}
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// loadSeccompProfile loads the profile passed by the runner, or the raw numbers of ALLOWED_SYSCALLS
+func loadSeccompProfile(enable_network bool) error {
+	profile, err := seccomp_profile.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	if profile == nil && os.Getenv("ALLOWED_SYSCALLS") != "" {
+		return seccompFromAllowedSyscalls()
+	}
+
+	if profile == nil {
+		// started without a profile, fall back to the default tier
+		profile, err = seccomp_profile.Get(
+			seccomp_profile.SecurityProfileName("python3", seccomp_profile.SECURITY_PROFILE_STANDARD),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return lib.SeccompProfile(profile, enable_network)
+}
+
+// seccompFromAllowedSyscalls loads the raw syscall numbers of ALLOWED_SYSCALLS
+func seccompFromAllowedSyscalls() error {
+	allowed_syscalls := []int{}
+	allowed_not_kill_syscalls := []int{}
+	allowed_not_kill_syscalls = append(allowed_not_kill_syscalls, python_syscall.ALLOW_ERROR_SYSCALLS...)
+
+	nums := strings.Split(os.Getenv("ALLOWED_SYSCALLS"), ",")
+	for num := range nums {
+		syscall, err := strconv.Atoi(nums[num])
+		if err != nil {
+			continue
+		}
+		allowed_syscalls = append(allowed_syscalls, syscall)
+	}
+
+	return lib.Seccomp(allowed_syscalls, allowed_not_kill_syscalls)
+}
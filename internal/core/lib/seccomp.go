@@ -3,6 +3,7 @@ package lib
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"os"
 	"syscall"
 	"unsafe"
@@ -11,17 +12,11 @@ import (
 )
 
 func Seccomp(allowed_syscalls []int, allowed_not_kill_syscalls []int) error {
-	ctx, err := sg.NewFilter(sg.ActKillProcess)
+	ctx, err := sg.NewFilter(killAction())
 	if err != nil {
 		return err
 	}
-
-	reader, writer, err := os.Pipe()
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-	defer writer.Close()
+	defer ctx.Release()
 
 	for _, syscall := range allowed_syscalls {
 		ctx.AddRule(sg.ScmpSyscall(syscall), sg.ActAllow)
@@ -31,21 +26,55 @@ func Seccomp(allowed_syscalls []int, allowed_not_kill_syscalls []int) error {
 		ctx.AddRule(sg.ScmpSyscall(syscall), sg.ActErrno)
 	}
 
-	file := os.NewFile(uintptr(writer.Fd()), "pipe")
-	ctx.ExportBPF(file)
+	return loadFilter(ctx)
+}
 
-	// read from pipe
-	data := make([]byte, 4096)
-	n, err := reader.Read(data)
+// loadFilter loads the filter for every thread, the listener is handed over to the runner
+// if blocked syscalls are reported
+func loadFilter(ctx *sg.ScmpFilter) error {
+	if syscall_report_fd < 0 {
+		_, err := loadFilterWithFlags(ctx, SeccompFilterFlagTSYNC)
+		return err
+	}
+
+	listener, err := loadFilterWithFlags(
+		ctx,
+		SeccompFilterFlagTSYNC|SeccompFilterFlagTSYNCESRCH|SeccompFilterFlagNewListener,
+	)
 	if err != nil {
 		return err
 	}
+
+	return handOverListener(listener)
+}
+
+// loadFilterWithFlags loads the filter through the seccomp syscall, the result is the
+// listener fd if SeccompFilterFlagNewListener is set
+func loadFilterWithFlags(ctx *sg.ScmpFilter, flags uintptr) (int, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return -1, err
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	err = ctx.ExportBPF(writer)
+	if err != nil {
+		return -1, err
+	}
+	writer.Close()
+
+	// read from pipe
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return -1, err
+	}
 	// load bpf
-	sock_filters := make([]syscall.SockFilter, n/8)
+	sock_filters := make([]syscall.SockFilter, len(data)/8)
 	bytesBuffer := bytes.NewBuffer(data)
 	err = binary.Read(bytesBuffer, binary.LittleEndian, &sock_filters)
 	if err != nil {
-		return err
+		return -1, err
 	}
 
 	bpf := syscall.SockFprog{
@@ -53,16 +82,16 @@ func Seccomp(allowed_syscalls []int, allowed_not_kill_syscalls []int) error {
 		Filter: &sock_filters[0],
 	}
 
-	_, _, err2 := syscall.Syscall(
+	fd, _, err2 := syscall.Syscall(
 		SYS_SECCOMP,
 		uintptr(SeccompSetModeFilter),
-		uintptr(SeccompFilterFlagTSYNC),
+		flags,
 		uintptr(unsafe.Pointer(&bpf)),
 	)
 
 	if err2 != 0 {
-		return err2
+		return -1, err2
 	}
 
-	return nil
+	return int(fd), nil
 }
@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"syscall"
+
+	sg "github.com/seccomp/libseccomp-golang"
+)
+
+const (
+	SeccompFilterFlagNewListener = 0x8
+	SeccompFilterFlagTSYNCESRCH  = 0x10
+)
+
+// SeccompLearn loads a filter which passes every syscall to a supervisor instead of a profile,
+// the supervisor takes the listener from /proc/<pid>/fd, records the syscall and lets it continue
+func SeccompLearn() error {
+	// every syscall is let through, there is nothing to report
+	err := closeSyscallReport()
+	if err != nil {
+		return err
+	}
+
+	ctx, err := sg.NewFilter(sg.ActNotify)
+	if err != nil {
+		return err
+	}
+	defer ctx.Release()
+
+	fd, err := loadFilterWithFlags(
+		ctx,
+		SeccompFilterFlagTSYNC|SeccompFilterFlagTSYNCESRCH|SeccompFilterFlagNewListener,
+	)
+	if err != nil {
+		return err
+	}
+
+	// close is the first syscall passed to the supervisor, it only returns once the
+	// supervisor has taken its own copy of the listener
+	return syscall.Close(fd)
+}
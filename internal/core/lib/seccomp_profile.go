@@ -0,0 +1,190 @@
+package lib
+
+import (
+	"fmt"
+
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
+	sg "github.com/seccomp/libseccomp-golang"
+)
+
+func profileAction(action string, errno_code int) (sg.ScmpAction, error) {
+	switch action {
+	case seccomp_profile.ACTION_KILL_PROCESS:
+		return killAction(), nil
+	case seccomp_profile.ACTION_KILL_THREAD:
+		return sg.ActKillThread, nil
+	case seccomp_profile.ACTION_ERRNO:
+		return sg.ActErrno.SetReturnCode(int16(errno_code)), nil
+	case seccomp_profile.ACTION_TRAP:
+		return sg.ActTrap, nil
+	case seccomp_profile.ACTION_LOG:
+		return sg.ActLog, nil
+	case seccomp_profile.ACTION_ALLOW:
+		return sg.ActAllow, nil
+	}
+
+	return sg.ActInvalid, fmt.Errorf("unknown seccomp action %s", action)
+}
+
+// SeccompProfile loads a filter built from a named profile,
+// syscall names are resolved for the architecture we are running on
+func SeccompProfile(profile *seccomp_profile.SeccompProfile, enable_network bool) error {
+	default_action, err := profileAction(profile.DefaultAction, profile.ErrnoCode)
+	if err != nil {
+		return err
+	}
+
+	ctx, err := sg.NewFilter(default_action)
+	if err != nil {
+		return err
+	}
+	defer ctx.Release()
+
+	add_rules := func(names []string, action string) error {
+		act, err := profileAction(action, profile.ErrnoCode)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			syscall, err := sg.GetSyscallFromName(name)
+			if err != nil {
+				return fmt.Errorf("seccomp profile %s: unknown syscall %s", profile.Name, name)
+			}
+
+			// rules matching the default action are rejected by libseccomp
+			if act == default_action {
+				continue
+			}
+
+			err = ctx.AddRule(syscall, act)
+			if err != nil {
+				return fmt.Errorf("seccomp profile %s: failed to add rule for %s: %v", profile.Name, name, err)
+			}
+		}
+
+		return nil
+	}
+
+	if err := add_rules(profile.Allow, seccomp_profile.ACTION_ALLOW); err != nil {
+		return err
+	}
+
+	if enable_network {
+		if err := add_rules(profile.Network, seccomp_profile.ACTION_ALLOW); err != nil {
+			return err
+		}
+	}
+
+	if err := add_rules(profile.Errno, seccomp_profile.ACTION_ERRNO); err != nil {
+		return err
+	}
+
+	if err := add_rules(profile.Kill, seccomp_profile.ACTION_KILL_PROCESS); err != nil {
+		return err
+	}
+
+	// denying rules go first, libseccomp checks conditions in the order they were added
+	for _, denies := range []bool{true, false} {
+		for _, rule := range profile.Rules {
+			if rule.Denies() != denies || (rule.Network && !enable_network) {
+				continue
+			}
+
+			err := addConditionalRule(ctx, &rule)
+			if err != nil {
+				return fmt.Errorf("seccomp profile %s: %v", profile.Name, err)
+			}
+		}
+	}
+
+	return loadFilter(ctx)
+}
+
+var compareOps = map[string]sg.ScmpCompareOp{
+	seccomp_profile.OP_EQUAL:         sg.CompareEqual,
+	seccomp_profile.OP_NOT_EQUAL:     sg.CompareNotEqual,
+	seccomp_profile.OP_LESS:          sg.CompareLess,
+	seccomp_profile.OP_LESS_EQUAL:    sg.CompareLessOrEqual,
+	seccomp_profile.OP_GREATER:       sg.CompareGreater,
+	seccomp_profile.OP_GREATER_EQUAL: sg.CompareGreaterEqual,
+	seccomp_profile.OP_MASKED_EQUAL:  sg.CompareMaskedEqual,
+}
+
+// addConditionalRule adds a rule of a profile, rules matching the default action are rejected by Validate
+func addConditionalRule(ctx *sg.ScmpFilter, rule *seccomp_profile.SeccompRule) error {
+	act, err := profileAction(rule.Action, rule.ErrnoCode)
+	if err != nil {
+		return err
+	}
+
+	syscall, err := sg.GetSyscallFromName(rule.Syscall)
+	if err != nil {
+		return fmt.Errorf("unknown syscall %s", rule.Syscall)
+	}
+
+	conditions := []sg.ScmpCondition{}
+	for _, arg := range rule.Args {
+		op, ok := compareOps[arg.Op]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", arg.Op)
+		}
+
+		value, err := seccomp_profile.ParseArgValue(arg.Value)
+		if err != nil {
+			return err
+		}
+
+		values := []uint64{value}
+		if op == sg.CompareMaskedEqual {
+			mask, err := seccomp_profile.ParseArgValue(arg.Mask)
+			if err != nil {
+				return err
+			}
+			values = []uint64{mask, value}
+		}
+
+		condition, err := sg.MakeCondition(arg.Index, op, values...)
+		if err != nil {
+			return fmt.Errorf("rule of %s: %v", rule.Syscall, err)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if len(conditions) == 0 {
+		err = ctx.AddRule(syscall, act)
+	} else {
+		err = ctx.AddRuleConditional(syscall, act, conditions)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add rule for %s: %v", rule.Syscall, err)
+	}
+
+	return nil
+}
+
+// ProfileSyscalls resolves the syscalls allowed by a profile to numbers of the architecture we are running on,
+// syscalls which are only allowed for some arguments are included
+func ProfileSyscalls(profile *seccomp_profile.SeccompProfile, enable_network bool) ([]int, error) {
+	names := append([]string{}, profile.Allow...)
+	if enable_network {
+		names = append(names, profile.Network...)
+	}
+
+	for _, rule := range profile.Rules {
+		if rule.Action == seccomp_profile.ACTION_ALLOW && (!rule.Network || enable_network) {
+			names = append(names, rule.Syscall)
+		}
+	}
+
+	syscalls := []int{}
+	for _, name := range names {
+		syscall, err := sg.GetSyscallFromName(name)
+		if err != nil {
+			return nil, fmt.Errorf("seccomp profile %s: unknown syscall %s", profile.Name, name)
+		}
+		syscalls = append(syscalls, int(syscall))
+	}
+
+	return syscalls, nil
+}
@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
+	sg "github.com/seccomp/libseccomp-golang"
+)
+
+var syscall_report_fd = -1
+
+// SetupSyscallReport reads the fd passed in ENV_SYSCALL_REPORT_FD, filters loaded afterwards pass a
+// blocked syscall to the runner through a seccomp listener, which names it and kills the process
+func SetupSyscallReport() error {
+	fd_str := os.Getenv(seccomp_profile.ENV_SYSCALL_REPORT_FD)
+	if fd_str == "" {
+		return nil
+	}
+
+	fd, err := strconv.Atoi(fd_str)
+	if err != nil {
+		return err
+	}
+
+	syscall_report_fd = fd
+	return nil
+}
+
+// closeSyscallReport closes the fd of the runner without handing over a listener
+func closeSyscallReport() error {
+	if syscall_report_fd < 0 {
+		return nil
+	}
+
+	fd := syscall_report_fd
+	syscall_report_fd = -1
+	return syscall.Close(fd)
+}
+
+// killAction is the action of syscalls which are not allowed to continue, the thread making a
+// blocked syscall waits for the runner to kill the process instead of continuing
+func killAction() sg.ScmpAction {
+	if syscall_report_fd >= 0 {
+		return sg.ActNotify
+	}
+	return sg.ActKillProcess
+}
+
+// handOverListener sends the number of the listener to the runner and waits until it has taken
+// its own copy, both fds are closed before untrusted code runs so it can neither answer its own
+// notifications nor talk to the runner
+func handOverListener(listener int) error {
+	fd := syscall_report_fd
+	syscall_report_fd = -1
+	defer syscall.Close(fd)
+	defer syscall.Close(listener)
+
+	_, err := syscall.Write(fd, []byte(fmt.Sprintf("%d\n", listener)))
+	if err != nil {
+		return err
+	}
+
+	ack := make([]byte, 1)
+	n, err := syscall.Read(fd, ack)
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return errors.New("runner did not take the seccomp listener")
+	}
+
+	return nil
+}
+
+// SyscallName resolves a syscall number of the architecture we are running on
+func SyscallName(nr int) string {
+	name, err := sg.ScmpSyscall(nr).GetName()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
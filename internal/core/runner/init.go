@@ -1,15 +1,43 @@
 package runner
 
 import (
+	"errors"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"syscall"
 
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
 	"github.com/langgenius/dify-sandbox/internal/static"
 	"github.com/langgenius/dify-sandbox/internal/utils/log"
 )
 
-func init() {
+// Setup prepares the identities executions run as and checks landlock support, it must be called after the configuration is loaded
+func Setup() {
+	config := static.GetDifySandboxGlobalConfigurations()
+	setupLandlock()
+
+	if config.Rootless {
+		err := checkRootlessSupport()
+		if err == nil {
+			static.SANDBOX_ROOTLESS = true
+			log.Info("rootless mode enabled, executions are isolated with user namespaces")
+			return
+		}
+
+		if os.Geteuid() != 0 {
+			log.Panic("rootless mode is not supported: %v, privileged mode requires running as root", err)
+		}
+		log.Warn("rootless mode is not supported: %v, falling back to privileged mode", err)
+	}
+
+	setupSandboxUser()
+	setupUidPool(config.SandboxUidPool.Start, config.SandboxUidPool.Size)
+	log.Info("sandbox uid pool: %d-%d", config.SandboxUidPool.Start, config.SandboxUidPool.Start+config.SandboxUidPool.Size-1)
+}
+
+func setupSandboxUser() {
 	// create sandbox user
 	user := static.SANDBOX_USER
 	uid := static.SANDBOX_USER_UID
@@ -35,3 +63,48 @@ func init() {
 		log.Panic("failed to convert gid: %v", err)
 	}
 }
+
+// checkRootlessSupport checks executions can be isolated without host users, they run as the
+// server user inside their user namespace and only landlock keeps them off the files it owns
+func checkRootlessSupport() error {
+	if lib.LandlockABI() == 0 {
+		return errors.New("landlock is not supported by the kernel, executions would run with access to the files of the server user")
+	}
+
+	return checkUserNamespaceSupport()
+}
+
+func checkUserNamespaceSupport() error {
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		return errors.New("kernel is built without user namespaces")
+	}
+
+	max_user_namespaces, err := os.ReadFile("/proc/sys/user/max_user_namespaces")
+	if err == nil && strings.TrimSpace(string(max_user_namespaces)) == "0" {
+		return errors.New("user namespaces are disabled by user.max_user_namespaces")
+	}
+
+	// debian and ubuntu kernels gate unprivileged user namespaces behind this sysctl
+	unprivileged_userns_clone, err := os.ReadFile("/proc/sys/kernel/unprivileged_userns_clone")
+	if err == nil && strings.TrimSpace(string(unprivileged_userns_clone)) == "0" && os.Geteuid() != 0 {
+		return errors.New("unprivileged user namespaces are disabled by kernel.unprivileged_userns_clone")
+	}
+
+	// seccomp profiles of container runtimes may still forbid it, try to spawn a process
+	true_path, err := exec.LookPath("true")
+	if err != nil {
+		return nil
+	}
+
+	cmd := exec.Command(true_path)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS,
+		UidMappings: userNamespaceUidMappings(),
+		GidMappings: userNamespaceGidMappings(),
+	}
+	if err := cmd.Run(); err != nil {
+		return errors.New("failed to spawn a process in a user namespace: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+)
+
+// SANDBOX_PROC_PATH is the private procfs of an execution, it only shows the pid namespace of the execution
+const SANDBOX_PROC_PATH = "/proc"
+
+func setupLandlock() {
+	abi := lib.LandlockABI()
+	if abi == 0 {
+		log.Warn("landlock is not supported by the kernel, filesystem access is only confined by chroot")
+		return
+	}
+
+	log.Info("landlock abi %d enabled, filesystem access is confined by chroot and landlock", abi)
+}
+
+// LandlockEnv tells the sandboxed process which paths of its root stay accessible, the library
+// paths of the runtime and the private procfs are read only, the scratch directory is writable
+func LandlockEnv(lib_paths []string) []string {
+	read_paths := append([]string{SANDBOX_PROC_PATH}, lib_paths...)
+	write_paths := []string{lib.SCRATCH_MOUNT_PATH}
+
+	return []string{
+		fmt.Sprintf("%s=%s", lib.ENV_LANDLOCK_READ_PATHS, strings.Join(read_paths, ":")),
+		fmt.Sprintf("%s=%s", lib.ENV_LANDLOCK_WRITE_PATHS, strings.Join(write_paths, ":")),
+	}
+}
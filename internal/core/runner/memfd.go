@@ -0,0 +1,57 @@
+package runner
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	MFD_CLOEXEC       = 0x1
+	MFD_ALLOW_SEALING = 0x2
+
+	F_ADD_SEALS    = 1033
+	F_SEAL_SEAL    = 0x1
+	F_SEAL_SHRINK  = 0x2
+	F_SEAL_GROW    = 0x4
+	F_SEAL_WRITE   = 0x8
+	MEMFD_ALL_SEAL = F_SEAL_SEAL | F_SEAL_SHRINK | F_SEAL_GROW | F_SEAL_WRITE
+)
+
+// NewSealedMemfd returns an anonymous in-memory file holding data, it's sealed against any further
+// modification and rewound, so it can be inherited by a sandboxed process through cmd.ExtraFiles
+// without ever touching the disk, the caller must close it once the process is started
+func NewSealedMemfd(name string, data []byte) (*os.File, error) {
+	name_ptr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, _, e := syscall.Syscall(SYS_MEMFD_CREATE, uintptr(unsafe.Pointer(name_ptr)), MFD_CLOEXEC|MFD_ALLOW_SEALING, 0)
+	if e != 0 {
+		return nil, e
+	}
+
+	file := os.NewFile(fd, name)
+
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	_, _, e = syscall.Syscall(syscall.SYS_FCNTL, fd, F_ADD_SEALS, MEMFD_ALL_SEAL)
+	if e != 0 {
+		file.Close()
+		return nil, e
+	}
+
+	// the offset is shared with the child, it must start reading from the beginning
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
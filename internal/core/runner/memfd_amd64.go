@@ -0,0 +1,7 @@
+//go:build linux && amd64
+
+package runner
+
+const (
+	SYS_MEMFD_CREATE = 319
+)
@@ -0,0 +1,9 @@
+//go:build linux && arm64
+
+package runner
+
+import "syscall"
+
+const (
+	SYS_MEMFD_CREATE = syscall.SYS_MEMFD_CREATE
+)
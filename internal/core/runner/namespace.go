@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
+	"github.com/langgenius/dify-sandbox/internal/static"
+)
+
+// NewSandboxSysProcAttr returns the process attributes used to spawn a sandboxed process,
+// every execution gets its own pid, mount, ipc and uts namespaces so processes from
+// concurrent requests are invisible to each other
+//
+// executions without network are started in a fresh network namespace which only contains
+// the loopback interface, so network denial is enforced by the kernel instead of seccomp only
+//
+// in rootless mode a user namespace maps root inside the sandbox to the unprivileged server user,
+// which owns all the other namespaces and allows chroot and mounts without host privileges
+func NewSandboxSysProcAttr(options *types.RunnerOptions) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+	}
+
+	if !options.EnableNetwork {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	if static.SANDBOX_ROOTLESS {
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = userNamespaceUidMappings()
+		attr.GidMappings = userNamespaceGidMappings()
+	}
+
+	return attr
+}
+
+// AcquireSandboxCredential returns the uid and gid the sandboxed process switches to,
+// no other running execution shares them, release must be called once the execution
+// has exited and the files it owns are cleaned up, waiting for a free uid fails after timeout
+//
+// only root is mapped in the user namespace of rootless mode, it is the server user on the host,
+// so rootless mode is refused unless landlock confines executions to their own files
+func AcquireSandboxCredential(timeout time.Duration) (int, int, func(), error) {
+	if static.SANDBOX_ROOTLESS {
+		return 0, 0, func() {}, nil
+	}
+
+	pool := getUidPool()
+	if pool == nil {
+		return static.SANDBOX_USER_UID, static.SANDBOX_GROUP_ID, func() {}, nil
+	}
+
+	uid, err := pool.Acquire(timeout)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	once := sync.Once{}
+	return uid, uid, func() {
+		once.Do(func() {
+			pool.Release(uid)
+		})
+	}, nil
+}
+
+func userNamespaceUidMappings() []syscall.SysProcIDMap {
+	return []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Geteuid(), Size: 1},
+	}
+}
+
+func userNamespaceGidMappings() []syscall.SysProcIDMap {
+	return []syscall.SysProcIDMap{
+		{ContainerID: 0, HostID: os.Getegid(), Size: 1},
+	}
+}
+
+// ReadonlyMount is a host directory or file the sandboxed process mounts read only into its root
+type ReadonlyMount struct {
+	HostPath    string
+	SandboxPath string
+}
+
+// ReadonlyMountEnv tells the sandboxed process which host paths to mount, in order
+func ReadonlyMountEnv(mounts []ReadonlyMount) string {
+	pairs := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		pairs = append(pairs, mount.HostPath+"="+mount.SandboxPath)
+	}
+
+	return fmt.Sprintf("%s=%s", lib.ENV_READONLY_MOUNTS, strings.Join(pairs, ":"))
+}
+
+// ChownSandboxFile hands a file over to the uid and gid of an execution,
+// in rootless mode files of the server user are already owned by root inside the sandbox
+func ChownSandboxFile(path string, uid int, gid int) error {
+	if static.SANDBOX_ROOTLESS {
+		return nil
+	}
+
+	return os.Chown(path, uid, gid)
+}
@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
+	"github.com/langgenius/dify-sandbox/internal/static"
+)
+
+// useRootless switches rootless mode and the uid pool for the duration of a test
+func useRootless(t *testing.T, rootless bool, pool *UidPool) {
+	t.Helper()
+
+	previous_rootless := static.SANDBOX_ROOTLESS
+	sandbox_uid_pool_lock.Lock()
+	previous_pool := sandbox_uid_pool
+	sandbox_uid_pool = pool
+	sandbox_uid_pool_lock.Unlock()
+
+	static.SANDBOX_ROOTLESS = rootless
+	t.Cleanup(func() {
+		static.SANDBOX_ROOTLESS = previous_rootless
+		sandbox_uid_pool_lock.Lock()
+		sandbox_uid_pool = previous_pool
+		sandbox_uid_pool_lock.Unlock()
+	})
+}
+
+func TestSandboxCredentialRootless(t *testing.T) {
+	pool := NewUidPool(1000, 1)
+	useRootless(t, true, pool)
+
+	// root of the user namespace, the pool is not needed as no host uid is switched to
+	for i := 0; i < 2; i++ {
+		uid, gid, release, err := AcquireSandboxCredential(time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uid != 0 || gid != 0 {
+			t.Fatalf("unexpected credential %d:%d in rootless mode", uid, gid)
+		}
+		release()
+	}
+
+	uid, err := pool.Acquire(time.Millisecond)
+	if err != nil || uid != 1000 {
+		t.Fatalf("the pool was used in rootless mode: %d, %v", uid, err)
+	}
+}
+
+func TestSandboxCredentialPrivileged(t *testing.T) {
+	useRootless(t, false, NewUidPool(1000, 1))
+
+	uid, gid, release, err := AcquireSandboxCredential(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != 1000 || gid != 1000 {
+		t.Fatalf("unexpected credential %d:%d from the pool", uid, gid)
+	}
+
+	if _, _, _, err := AcquireSandboxCredential(time.Millisecond); err == nil {
+		t.Fatal("acquired a second credential from a pool of one")
+	}
+
+	// releasing twice must not hand the uid out twice
+	release()
+	release()
+	if _, _, _, err := AcquireSandboxCredential(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := AcquireSandboxCredential(time.Millisecond); err == nil {
+		t.Fatal("a uid released twice was handed out twice")
+	}
+}
+
+func TestSandboxSysProcAttr(t *testing.T) {
+	namespaces := uintptr(syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+
+	for _, c := range []struct {
+		rootless bool
+		network  bool
+		flags    uintptr
+	}{
+		{rootless: false, network: false, flags: namespaces | syscall.CLONE_NEWNET},
+		{rootless: false, network: true, flags: namespaces},
+		{rootless: true, network: false, flags: namespaces | syscall.CLONE_NEWNET | syscall.CLONE_NEWUSER},
+		{rootless: true, network: true, flags: namespaces | syscall.CLONE_NEWUSER},
+	} {
+		useRootless(t, c.rootless, nil)
+
+		attr := NewSandboxSysProcAttr(&types.RunnerOptions{EnableNetwork: c.network})
+		if attr.Cloneflags != c.flags {
+			t.Errorf("rootless %v, network %v: unexpected clone flags %#x", c.rootless, c.network, attr.Cloneflags)
+		}
+
+		if !c.rootless {
+			if len(attr.UidMappings) != 0 || len(attr.GidMappings) != 0 {
+				t.Errorf("ids are mapped without a user namespace")
+			}
+			continue
+		}
+
+		// only root is mapped, to the server user
+		uid_mappings := []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}}
+		gid_mappings := []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}}
+		if len(attr.UidMappings) != 1 || attr.UidMappings[0] != uid_mappings[0] {
+			t.Errorf("unexpected uid mappings %v", attr.UidMappings)
+		}
+		if len(attr.GidMappings) != 1 || attr.GidMappings[0] != gid_mappings[0] {
+			t.Errorf("unexpected gid mappings %v", attr.GidMappings)
+		}
+	}
+}
+
+func TestScratchRootless(t *testing.T) {
+	useRootless(t, true, nil)
+
+	// the sandboxed process mounts the tmpfs itself, the server can not
+	scratch, err := NewScratch(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scratch.Remove()
+
+	if !strings.HasPrefix(scratch.Env(), lib.ENV_SCRATCH_SIZE+"=") {
+		t.Fatalf("unexpected scratch env %s in rootless mode", scratch.Env())
+	}
+	if scratch.QuotaExceeded() {
+		t.Fatal("quota of a scratch directory the server can not see was exceeded")
+	}
+}
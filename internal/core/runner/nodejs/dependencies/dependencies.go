@@ -0,0 +1,361 @@
+package dependencies
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/langgenius/dify-sandbox/internal/core/chroot"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
+	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+)
+
+const (
+	// PACKAGES_PATH holds the versions of the node modules installed from NODEJS_REQUIREMENTS_PATH,
+	// the node_modules of the active one is mounted read only into executions
+	PACKAGES_PATH = "/var/sandbox/nodejs-packages"
+)
+
+var (
+	// MODULES_PATH is where executions find the node modules through NODE_PATH
+	MODULES_PATH = path.Join(PACKAGES_PATH, "node_modules")
+
+	// versions keeps the node_modules an execution uses until it has exited, an install
+	// activates a new version instead of replacing the files of the running one
+	versions      = chroot.NewVersions(PACKAGES_PATH)
+	versions_once sync.Once
+)
+
+func getVersions() *chroot.Versions {
+	versions_once.Do(func() {
+		err := versions.Load()
+		if err != nil {
+			log.Warn("failed to load the installed nodejs dependencies: %v", err)
+		}
+	})
+
+	return versions
+}
+
+// AcquireModules returns the node_modules of the active version and keeps it until release is
+// called, the path is empty if no node modules were installed
+func AcquireModules() (string, func(), error) {
+	versions := getVersions()
+	if active, _ := versions.Active(); active == 0 {
+		return "", func() {}, nil
+	}
+
+	version_path, release, err := versions.Acquire()
+	if err != nil {
+		return "", nil, err
+	}
+
+	modules := path.Join(version_path, "node_modules")
+	if _, err := os.Stat(modules); err != nil {
+		release()
+		return "", func() {}, nil
+	}
+
+	return modules, release, nil
+}
+
+// module is a node module found in node_modules by its package.json
+type module struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies map[string]string `json:"dependencies"`
+	Optional     map[string]string `json:"optionalDependencies"`
+}
+
+// InstallDependencies installs the node modules of a package.json into a new version, which is
+// activated once npm succeeded, output receives the output of npm
+func InstallDependencies(requirements string, output io.Writer) error {
+	if strings.TrimSpace(requirements) == "" {
+		return nil
+	}
+
+	package_json, err := preparePackageJson(requirements)
+	if err != nil {
+		return err
+	}
+
+	versions := getVersions()
+	version, err := versions.Create()
+	if err != nil {
+		return err
+	}
+	dir := versions.Path(version)
+
+	// npm is not needed to install nothing, images may ship node without it
+	if hasDependencies(requirements) {
+		err = npmInstall(dir, package_json, npmCacheArgs(), output)
+		if err != nil {
+			versions.Discard(version)
+			return err
+		}
+	}
+
+	// a package.json without dependencies leaves no node_modules behind
+	err = os.MkdirAll(path.Join(dir, "node_modules"), 0755)
+	if err != nil {
+		versions.Discard(version)
+		return err
+	}
+
+	err = versions.Activate(version)
+	if err != nil {
+		versions.Discard(version)
+		return err
+	}
+
+	log.Info("nodejs dependencies installed as v%d", version)
+	return nil
+}
+
+// DownloadDependencies fills an npm cache with the node modules of a package.json, which
+// nodejs_npm_cache installs them from without network access
+func DownloadDependencies(requirements string, cache string, output io.Writer) error {
+	if strings.TrimSpace(requirements) == "" {
+		return nil
+	}
+
+	package_json, err := preparePackageJson(requirements)
+	if err != nil {
+		return err
+	}
+
+	staging, err := os.MkdirTemp("", "dify-sandbox-npm-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	return npmInstall(staging, package_json, []string{"--cache", cache, "--ignore-scripts"}, output)
+}
+
+func npmInstall(dir string, package_json []byte, args []string, output io.Writer) error {
+	err := os.WriteFile(path.Join(dir, "package.json"), package_json, 0644)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("npm", append([]string{"install", "--no-audit", "--no-fund", "--omit=dev"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdout = output
+	cmd.Stderr = output
+	return cmd.Run()
+}
+
+// npmCacheArgs returns where npm looks for packages, an npm cache replaces the registry
+func npmCacheArgs() []string {
+	cache := static.GetDifySandboxGlobalConfigurations().NodejsNpmCache
+	if cache == "" {
+		return []string{}
+	}
+
+	return []string{"--offline", "--cache", cache}
+}
+
+// preparePackageJson checks the requirements and makes relative file: dependencies, e.g. local
+// tarballs, absolute, npm would look for them next to the copy it installs from otherwise
+func preparePackageJson(requirements string) ([]byte, error) {
+	package_json := map[string]any{}
+	err := json.Unmarshal([]byte(requirements), &package_json)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nodejs requirements %s: %w", static.NODEJS_REQUIREMENTS_PATH, err)
+	}
+
+	base, err := filepath.Abs(path.Dir(static.NODEJS_REQUIREMENTS_PATH))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []string{"dependencies", "optionalDependencies"} {
+		dependencies, ok := package_json[field].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		for name, spec := range dependencies {
+			spec, ok := spec.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid nodejs requirements %s: version of %s is not a string", static.NODEJS_REQUIREMENTS_PATH, name)
+			}
+
+			file, ok := strings.CutPrefix(spec, "file:")
+			if ok && !path.IsAbs(file) {
+				dependencies[name] = "file:" + path.Join(base, file)
+			}
+		}
+	}
+
+	return json.MarshalIndent(package_json, "", "  ")
+}
+
+// hasDependencies reports whether a package.json requests any module
+func hasDependencies(requirements string) bool {
+	root := module{}
+	if json.Unmarshal([]byte(requirements), &root) != nil {
+		// npm reports what is wrong with it
+		return true
+	}
+
+	return len(root.Dependencies) > 0 || len(root.Optional) > 0
+}
+
+// ListDependencies returns the installed node modules with the dependencies of the requirements
+// which pulled them in, a module installed in several versions is listed once per version
+func ListDependencies() ([]types.Dependency, error) {
+	requested := map[string]string{}
+	if requirements := static.GetRunnerDependencies().NodejsRequirements; strings.TrimSpace(requirements) != "" {
+		root := module{}
+		err := json.Unmarshal([]byte(requirements), &root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nodejs requirements %s: %w", static.NODEJS_REQUIREMENTS_PATH, err)
+		}
+		for name, spec := range root.Optional {
+			requested[name] = spec
+		}
+		for name, spec := range root.Dependencies {
+			requested[name] = spec
+		}
+	}
+
+	node_modules, release, err := AcquireModules()
+	if err != nil {
+		return nil, err
+	}
+	modules, err := readModules(node_modules)
+	release()
+	if err != nil {
+		return nil, err
+	}
+
+	by_name := map[string][]*module{}
+	for _, installed := range modules {
+		by_name[installed.Name] = append(by_name[installed.Name], installed)
+	}
+
+	// every module a requested one depends on, directly or transitively, is attributed to it
+	required_by := map[string]map[string]bool{}
+	for name := range requested {
+		queue := []string{name}
+		visited := map[string]bool{name: true}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			for _, instance := range by_name[current] {
+				for _, dependencies := range []map[string]string{instance.Dependencies, instance.Optional} {
+					for dependency := range dependencies {
+						if visited[dependency] || by_name[dependency] == nil {
+							continue
+						}
+						visited[dependency] = true
+						queue = append(queue, dependency)
+
+						if required_by[dependency] == nil {
+							required_by[dependency] = map[string]bool{}
+						}
+						required_by[dependency][name] = true
+					}
+				}
+			}
+		}
+	}
+
+	dependencies := []types.Dependency{}
+	seen := map[string]bool{}
+	for _, installed := range modules {
+		key := installed.Name + "@" + installed.Version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		dependency := types.Dependency{
+			Name:        installed.Name,
+			Version:     installed.Version,
+			Requirement: requested[installed.Name],
+		}
+		for name := range required_by[installed.Name] {
+			dependency.RequiredBy = append(dependency.RequiredBy, name)
+		}
+		sort.Strings(dependency.RequiredBy)
+		dependencies = append(dependencies, dependency)
+	}
+
+	sort.Slice(dependencies, func(i, j int) bool {
+		if dependencies[i].Name != dependencies[j].Name {
+			return dependencies[i].Name < dependencies[j].Name
+		}
+		return dependencies[i].Version < dependencies[j].Version
+	})
+	return dependencies, nil
+}
+
+// readModules reads the package.json of every module in a node_modules directory, scoped ones
+// and the ones nested in their own node_modules included
+func readModules(node_modules string) ([]*module, error) {
+	entries, err := os.ReadDir(node_modules)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	modules := []*module{}
+	for _, entry := range entries {
+		// .bin and the hidden lockfile of npm
+		if strings.HasPrefix(entry.Name(), ".") || !entry.IsDir() {
+			continue
+		}
+
+		dirs := []string{path.Join(node_modules, entry.Name())}
+		if strings.HasPrefix(entry.Name(), "@") {
+			scope := dirs[0]
+			scoped, err := os.ReadDir(scope)
+			if err != nil {
+				return nil, err
+			}
+			dirs = []string{}
+			for _, entry := range scoped {
+				if entry.IsDir() {
+					dirs = append(dirs, path.Join(scope, entry.Name()))
+				}
+			}
+		}
+
+		for _, dir := range dirs {
+			content, err := os.ReadFile(path.Join(dir, "package.json"))
+			if err != nil {
+				// not a module, npm ignores it as well
+				continue
+			}
+
+			installed := &module{}
+			if json.Unmarshal(content, installed) != nil || installed.Name == "" {
+				continue
+			}
+			modules = append(modules, installed)
+
+			nested, err := readModules(path.Join(dir, "node_modules"))
+			if err != nil {
+				return nil, err
+			}
+			modules = append(modules, nested...)
+		}
+	}
+
+	return modules, nil
+}
@@ -0,0 +1,142 @@
+package dependencies
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/langgenius/dify-sandbox/internal/static"
+)
+
+func writeModule(t *testing.T, dir string, package_json string) {
+	t.Helper()
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path.Join(dir, "package.json"), []byte(package_json), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadModules(t *testing.T) {
+	node_modules := t.TempDir()
+
+	writeModule(t, path.Join(node_modules, "a"), `{"name": "a", "version": "1.0.0", "dependencies": {"b": "^2"}}`)
+	writeModule(t, path.Join(node_modules, "b"), `{"name": "b", "version": "2.1.0"}`)
+	// a second version of b nested below the module which needs it
+	writeModule(t, path.Join(node_modules, "a", "node_modules", "b"), `{"name": "b", "version": "1.0.0"}`)
+	writeModule(t, path.Join(node_modules, "@scope", "c"), `{"name": "@scope/c", "version": "3.0.0", "optionalDependencies": {"a": "*"}}`)
+	// neither are modules
+	writeModule(t, path.Join(node_modules, ".bin"), `{"name": "bin", "version": "1.0.0"}`)
+	writeModule(t, path.Join(node_modules, "invalid"), `{`)
+	writeModule(t, path.Join(node_modules, "unnamed"), `{"version": "1.0.0"}`)
+	err := os.MkdirAll(path.Join(node_modules, "empty"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modules, err := readModules(node_modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := []string{}
+	for _, installed := range modules {
+		found = append(found, installed.Name+"@"+installed.Version)
+	}
+	sort.Strings(found)
+
+	expected := []string{"@scope/c@3.0.0", "a@1.0.0", "b@1.0.0", "b@2.1.0"}
+	if len(found) != len(expected) {
+		t.Fatalf("unexpected modules %v", found)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Fatalf("unexpected modules %v", found)
+		}
+	}
+
+	for _, installed := range modules {
+		if installed.Name == "@scope/c" && installed.Optional["a"] != "*" {
+			t.Errorf("optional dependencies of %s were not read: %v", installed.Name, installed.Optional)
+		}
+	}
+}
+
+func TestReadModulesMissing(t *testing.T) {
+	// nothing is installed yet
+	modules, err := readModules(path.Join(t.TempDir(), "node_modules"))
+	if err != nil || len(modules) != 0 {
+		t.Fatalf("unexpected modules %v, %v", modules, err)
+	}
+}
+
+func TestPreparePackageJson(t *testing.T) {
+	base, err := filepath.Abs(path.Dir(static.NODEJS_REQUIREMENTS_PATH))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prepared, err := preparePackageJson(`{
+		"name": "requirements",
+		"dependencies": {"local": "file:local-1.0.0.tgz", "absolute": "file:/opt/absolute.tgz", "registry": "^1.0.0"},
+		"optionalDependencies": {"nested": "file:vendor/nested"}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	package_json := struct {
+		Name         string            `json:"name"`
+		Dependencies map[string]string `json:"dependencies"`
+		Optional     map[string]string `json:"optionalDependencies"`
+	}{}
+	err = json.Unmarshal(prepared, &package_json)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// relative file: dependencies are relative to the requirements, anything else is kept
+	for name, expected := range map[string]string{
+		"local":    "file:" + path.Join(base, "local-1.0.0.tgz"),
+		"absolute": "file:/opt/absolute.tgz",
+		"registry": "^1.0.0",
+	} {
+		if package_json.Dependencies[name] != expected {
+			t.Errorf("%s: %s, expected %s", name, package_json.Dependencies[name], expected)
+		}
+	}
+	if package_json.Optional["nested"] != "file:"+path.Join(base, "vendor/nested") {
+		t.Errorf("unexpected optional dependency %s", package_json.Optional["nested"])
+	}
+	if package_json.Name != "requirements" {
+		t.Errorf("unexpected name %s", package_json.Name)
+	}
+
+	for _, invalid := range []string{`{`, `{"dependencies": {"a": 1}}`} {
+		if _, err := preparePackageJson(invalid); err == nil {
+			t.Errorf("invalid requirements %s were accepted", invalid)
+		}
+	}
+}
+
+func TestHasDependencies(t *testing.T) {
+	for requirements, expected := range map[string]bool{
+		`{"dependencies": {}}`:                                 false,
+		`{"name": "requirements"}`:                             false,
+		`{"dependencies": {"a": "^1"}}`:                        true,
+		`{"optionalDependencies": {"a": "^1"}}`:                true,
+		`{"dependencies": {}, "devDependencies": {"a": "^1"}}`: false,
+	} {
+		if hasDependencies(requirements) != expected {
+			t.Errorf("%s has dependencies: %v, expected %v", requirements, !expected, expected)
+		}
+	}
+}
@@ -2,31 +2,38 @@ package nodejs
 
 import (
 	_ "embed"
-	"encoding/base64"
 	"fmt"
 	"os"
 	"os/exec"
-	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/langgenius/dify-sandbox/internal/core/runner"
+	nodejs_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/nodejs/dependencies"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
 )
 
 type NodeJsRunner struct {
 	runner.TempDirRunner
 }
 
+const (
+	PRELOAD_FD = 3
+	CODE_FD    = 4
+	REPORT_FD  = 5
+)
+
 //go:embed prescript.js
 var nodejs_sandbox_fs []byte
 
 var (
+	// REQUIRED_FS is mounted read only into the root of every execution instead of being copied,
+	// paths missing on the host are skipped
 	REQUIRED_FS = []string{
-		path.Join(LIB_PATH, PROJECT_NAME, "node_temp"),
-		path.Join(LIB_PATH, LIB_NAME),
+		LIB_PATH,
 		"/etc/ssl/certs/ca-certificates.crt",
 		"/etc/nsswitch.conf",
 		"/etc/resolv.conf",
@@ -35,6 +42,23 @@ var (
 	}
 )
 
+// requiredMounts returns the mounts of REQUIRED_FS and of the node modules if there are any
+func requiredMounts(modules string) []runner.ReadonlyMount {
+	mounts := []runner.ReadonlyMount{}
+	for _, required := range REQUIRED_FS {
+		if _, err := os.Stat(required); err != nil {
+			continue
+		}
+		mounts = append(mounts, runner.ReadonlyMount{HostPath: required, SandboxPath: required})
+	}
+
+	if modules != "" {
+		mounts = append(mounts, runner.ReadonlyMount{HostPath: modules, SandboxPath: nodejs_dependencies.MODULES_PATH})
+	}
+
+	return mounts
+}
+
 func (p *NodeJsRunner) Run(
 	code string,
 	timeout time.Duration,
@@ -48,76 +72,146 @@ func (p *NodeJsRunner) Run(
 	output_handler := runner.NewOutputCaptureRunner()
 	output_handler.SetTimeout(timeout)
 
-	err := p.WithTempDir("/", REQUIRED_FS, func(root_path string) error {
+	// executions waiting for a uid would not finish within their timeout anyway
+	uid, gid, release_credential, err := runner.AcquireSandboxCredential(timeout)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the node modules are mounted instead of copied, the execution keeps their version
+	// even if another one is installed meanwhile
+	modules, release_modules, err := nodejs_dependencies.AcquireModules()
+	if err != nil {
+		release_credential()
+		return nil, nil, nil, err
+	}
+
+	// the root starts empty, everything the execution reads is mounted into it
+	err = p.WithTempDir("/", nil, func(root_path string) error {
 		output_handler.SetAfterExitHook(func() {
 			os.RemoveAll(root_path)
 			os.Remove(root_path)
+			// the uid owns nothing anymore, hand it to the next execution
+			release_credential()
+			release_modules()
 		})
 
 		// initialize the environment
-		script_path, err := p.InitializeEnvironment(code, preload, root_path)
+		script_path, preload_file, untrusted_code, err := p.InitializeEnvironment(code, preload, root_path, uid, gid)
 		if err != nil {
 			return err
 		}
+		// the child holds its own copies once started
+		defer preload_file.Close()
+		defer untrusted_code.Close()
 
-		// create a new process
+		report, err := runner.NewSyscallReport()
+		if err != nil {
+			return err
+		}
+
+		scratch, err := runner.NewScratch(uid, gid)
+		if err != nil {
+			report.Close()
+			return err
+		}
+
+		// create a new process, the preload and the untrusted code are inherited as fd 3 and 4,
+		// blocked syscalls are reported to fd 5
 		cmd := exec.Command(
 			static.GetDifySandboxGlobalConfigurations().NodejsPath,
 			script_path,
-			strconv.Itoa(static.SANDBOX_USER_UID),
-			strconv.Itoa(static.SANDBOX_GROUP_ID),
+			strconv.Itoa(uid),
+			strconv.Itoa(gid),
 			options.Json(),
+			strconv.Itoa(PRELOAD_FD),
+			strconv.Itoa(CODE_FD),
 		)
-		cmd.Env = []string{}
+		cmd.Dir = root_path
+		cmd.ExtraFiles = []*os.File{preload_file, untrusted_code, report.File()}
+		cmd.Env = []string{report.Env(REPORT_FD), scratch.Env()}
+		mounts := requiredMounts(modules)
+		read_paths := []string{}
+		for _, mount := range mounts {
+			read_paths = append(read_paths, mount.SandboxPath)
+		}
+		cmd.Env = append(cmd.Env, runner.ReadonlyMountEnv(mounts))
+		if modules != "" {
+			cmd.Env = append(cmd.Env, "NODE_PATH="+nodejs_dependencies.MODULES_PATH)
+		}
+		cmd.Env = append(cmd.Env, runner.LandlockEnv(read_paths)...)
+		cmd.SysProcAttr = runner.NewSandboxSysProcAttr(options)
 
-		if len(configuration.AllowedSyscalls) > 0 {
+		if options.Learner != nil {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=1", seccomp_profile.ENV_SECCOMP_LEARN))
+		} else if len(configuration.AllowedSyscalls) > 0 {
 			cmd.Env = append(
 				cmd.Env,
 				fmt.Sprintf("ALLOWED_SYSCALLS=%s", strings.Trim(
 					strings.Join(strings.Fields(fmt.Sprint(configuration.AllowedSyscalls)), ","), "[]",
 				)),
 			)
+		} else if configuration.SeccompProfiles.Nodejs != "" {
+			profile, err := seccomp_profile.Get(configuration.SeccompProfiles.Nodejs)
+			if err != nil {
+				report.Close()
+				scratch.Remove()
+				return err
+			}
+			cmd.Env = append(cmd.Env, profile.Env())
 		}
 
 		// capture the output
+		output_handler.SetSyscallReport(report)
+		output_handler.SetScratch(scratch)
 		err = output_handler.CaptureOutput(cmd)
 		if err != nil {
 			return err
 		}
 
+		if options.Learner != nil {
+			options.Learner.Attach(cmd.Process.Pid)
+		}
+
 		return nil
 	})
 
 	if err != nil {
+		release_credential()
+		release_modules()
 		return nil, nil, nil, err
 	}
 
 	return output_handler.GetStdout(), output_handler.GetStderr(), output_handler.GetDone(), nil
 }
 
-func (p *NodeJsRunner) InitializeEnvironment(code string, preload string, root_path string) (string, error) {
+func (p *NodeJsRunner) InitializeEnvironment(code string, preload string, root_path string, uid int, gid int) (string, *os.File, *os.File, error) {
 	if !checkLibAvaliable() {
 		releaseLibBinary()
 	}
 
-	node_sandbox_file := string(nodejs_sandbox_fs)
-	if preload != "" {
-		node_sandbox_file = fmt.Sprintf("%s\n%s", preload, node_sandbox_file)
+	// the root of the execution only holds mount points and what the execution writes there,
+	// keep other uids out of it
+	err := runner.ChownSandboxFile(root_path, uid, gid)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	err = os.Chmod(root_path, 0700)
+	if err != nil {
+		return "", nil, nil, err
 	}
 
-	// join nodejs_sandbox_fs and code
-	// encode code with base64
-	code = base64.StdEncoding.EncodeToString([]byte(code))
-	// FIXE: redeclared function causes code injection
-	evalCode := fmt.Sprintf("eval(Buffer.from('%s', 'base64').toString('utf-8'))", code)
-	code = node_sandbox_file + evalCode
+	// the preload and the code never touch the disk, they only live in sealed anonymous files
+	preload_file, err := runner.NewSealedMemfd("dify-sandbox-preload", []byte(preload))
+	if err != nil {
+		return "", nil, nil, err
+	}
 
-	// override root_path/tmp/sandbox-nodejs-project/prescript.js
-	script_path := path.Join(root_path, LIB_PATH, PROJECT_NAME, "node_temp/node_temp/test.js")
-	err := os.WriteFile(script_path, []byte(code), 0755)
+	code_file, err := runner.NewSealedMemfd("dify-sandbox-code", []byte(code))
 	if err != nil {
-		return "", err
+		preload_file.Close()
+		return "", nil, nil, err
 	}
 
-	return script_path, nil
+	return SCRIPT_PATH, preload_file, code_file, nil
 }
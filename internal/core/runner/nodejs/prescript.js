@@ -1,7 +1,8 @@
 const argv = process.argv
 
+const fs = require('fs')
 const koffi = require('koffi')
-const lib = koffi.load('./var/sandbox/sandbox-nodejs/nodejs.so')
+const lib = koffi.load('/var/sandbox/sandbox-nodejs/nodejs.so')
 const difySeccomp = lib.func('void DifySeccomp(int, int, bool)')
 
 const uid = parseInt(argv[2])
@@ -9,5 +10,18 @@ const gid = parseInt(argv[3])
 
 const options = JSON.parse(argv[4])
 
+// the preload and the untrusted code are delivered through inherited sealed memfds
+const preloadFd = parseInt(argv[5])
+const codeFd = parseInt(argv[6])
+
+const preload = fs.readFileSync(preloadFd, 'utf-8')
+fs.closeSync(preloadFd)
+const code = fs.readFileSync(codeFd, 'utf-8')
+fs.closeSync(codeFd)
+
+eval(preload)
+
 difySeccomp(uid, gid, options['enable_network'])
 
+// FIXE: redeclared function causes code injection, so the code is evaluated after seccomp
+eval(code)
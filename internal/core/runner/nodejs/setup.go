@@ -13,6 +13,10 @@ const (
 	LIB_PATH     = "/var/sandbox/sandbox-nodejs"
 	LIB_NAME     = "nodejs.so"
 	PROJECT_NAME = "nodejs-project"
+
+	// SCRIPT_PATH is the trusted prescript node is started with, next to the node modules it
+	// requires, it is read from the host before the execution switches to its own root
+	SCRIPT_PATH = LIB_PATH + "/" + PROJECT_NAME + "/node_temp/test.js"
 )
 
 //go:embed nodejs.so
@@ -82,6 +86,11 @@ func releaseLibBinary() {
 	if err != nil {
 		log.Panic("failed to copy nodejs project")
 	}
+
+	err = os.WriteFile(SCRIPT_PATH, nodejs_sandbox_fs, 0644)
+	if err != nil {
+		log.Panic(fmt.Sprintf("failed to write %s", SCRIPT_PATH))
+	}
 	log.Info("nodejs runner environment initialized")
 }
 
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
-	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +18,10 @@ type OutputCaptureRunner struct {
 	timeout time.Duration
 
 	after_exit_hook func()
+
+	syscall_report *SyscallReport
+
+	scratch *Scratch
 }
 
 func NewOutputCaptureRunner() *OutputCaptureRunner {
@@ -45,6 +48,18 @@ func (s *OutputCaptureRunner) SetAfterExitHook(hook func()) {
 	s.after_exit_hook = hook
 }
 
+// SetSyscallReport names the blocked syscall in the error if the process is killed by seccomp,
+// the report is closed once the process has exited or failed to start
+func (s *OutputCaptureRunner) SetSyscallReport(report *SyscallReport) {
+	s.syscall_report = report
+}
+
+// SetScratch reports quota breaches of the scratch directory, it is removed before the after-exit
+// hook or once the process failed to start
+func (s *OutputCaptureRunner) SetScratch(scratch *Scratch) {
+	s.scratch = scratch
+}
+
 func (s *OutputCaptureRunner) SetTimeout(timeout time.Duration) {
 	s.timeout = timeout
 }
@@ -65,9 +80,21 @@ func (s *OutputCaptureRunner) CaptureOutput(cmd *exec.Cmd) error {
 		}
 	})
 
+	// releases what the exit handling would have released if the process does not get to start
+	cleanup := func() {
+		timer.Stop()
+		if s.syscall_report != nil {
+			s.syscall_report.Close()
+		}
+		if s.scratch != nil {
+			s.scratch.Remove()
+		}
+	}
+
 	// create a pipe for the stdout
 	stdout_reader, err := cmd.StdoutPipe()
 	if err != nil {
+		cleanup()
 		return err
 	}
 
@@ -75,6 +102,7 @@ func (s *OutputCaptureRunner) CaptureOutput(cmd *exec.Cmd) error {
 	stderr_reader, err := cmd.StderrPipe()
 	if err != nil {
 		stdout_reader.Close()
+		cleanup()
 		return err
 	}
 
@@ -83,9 +111,14 @@ func (s *OutputCaptureRunner) CaptureOutput(cmd *exec.Cmd) error {
 	if err != nil {
 		stdout_reader.Close()
 		stderr_reader.Close()
+		cleanup()
 		return err
 	}
 
+	if s.syscall_report != nil {
+		s.syscall_report.Attach(cmd.Process.Pid)
+	}
+
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 
@@ -142,13 +175,27 @@ func (s *OutputCaptureRunner) CaptureOutput(cmd *exec.Cmd) error {
 			s.WriteError([]byte(fmt.Sprintf("error: %v\n", err)))
 		} else if status.ExitCode() != 0 {
 			exit_string := status.String()
-			if strings.Contains(exit_string, "bad system call") {
-				s.WriteError([]byte("error: operation not permitted\n"))
+			if message, ok := blockedSyscallError(s.syscall_report, status); ok {
+				s.WriteError([]byte(message))
 			} else {
 				s.WriteError([]byte(fmt.Sprintf("error: %v\n", exit_string)))
 			}
 		}
 
+		if s.scratch != nil && s.scratch.QuotaExceeded() {
+			s.WriteError([]byte(s.scratch.QuotaError()))
+		}
+
+		if s.syscall_report != nil {
+			s.syscall_report.Close()
+		}
+
+		// the scratch directory belongs to the uid of the execution, it has to be gone before
+		// the hook hands the uid to the next execution
+		if s.scratch != nil {
+			s.scratch.Remove()
+		}
+
 		if s.after_exit_hook != nil {
 			s.after_exit_hook()
 		}
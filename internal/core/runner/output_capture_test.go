@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCaptureOutputCleansUpBeforeStart(t *testing.T) {
+	for name, prepare := range map[string]func(cmd *exec.Cmd){
+		"stdout pipe": func(cmd *exec.Cmd) { cmd.Stdout = os.Stdout },
+		"stderr pipe": func(cmd *exec.Cmd) { cmd.Stderr = os.Stderr },
+		"start":       func(cmd *exec.Cmd) { cmd.Path = "/nonexistent" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			report, err := NewSyscallReport()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command("true")
+			prepare(cmd)
+
+			output_handler := NewOutputCaptureRunner()
+			output_handler.SetSyscallReport(report)
+			err = output_handler.CaptureOutput(cmd)
+			if err == nil {
+				t.Fatal("the process started")
+			}
+
+			for _, file := range []*os.File{report.conn, report.child} {
+				_, err := file.Write([]byte{0})
+				if !errors.Is(err, os.ErrClosed) {
+					t.Fatalf("%s was left open: %v", file.Name(), err)
+				}
+			}
+		})
+	}
+}
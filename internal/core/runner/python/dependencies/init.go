@@ -3,34 +3,49 @@ package dependencies
 import (
 	"sync"
 
-	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python/requirements"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
 )
 
-var preload_script_map = map[string]string{}
+// preload_script_map holds the packages the sandbox itself requires per dependency profile, by
+// normalized name, they are requested besides the requirements of the profile
+var preload_script_map = map[string]map[string]string{}
 var preload_script_map_lock = &sync.RWMutex{}
 
-func SetupDependency(package_name string, version string) {
+func SetupDependency(profile string, package_name string, requirement string) {
 	preload_script_map_lock.Lock()
 	defer preload_script_map_lock.Unlock()
-	preload_script_map[package_name] = version
+	if preload_script_map[profile] == nil {
+		preload_script_map[profile] = map[string]string{}
+	}
+	preload_script_map[profile][requirements.NormalizeName(package_name)] = requirement
 }
 
-func GetDependency(package_name string, version string) string {
+func GetDependency(profile string, package_name string) string {
 	preload_script_map_lock.RLock()
 	defer preload_script_map_lock.RUnlock()
-	return preload_script_map[package_name]
+	return preload_script_map[profile][requirements.NormalizeName(package_name)]
 }
 
-func ListDependencies() []types.Dependency {
-	dependencies := []types.Dependency{}
+// Requirements returns the requested packages of a profile by normalized name, listed are the
+// ones of its requirements file, they take precedence over the ones of the sandbox
+func Requirements(profile string, listed []*requirements.Requirement) map[string]*requirements.Requirement {
+	requested := map[string]*requirements.Requirement{}
+
 	preload_script_map_lock.RLock()
-	defer preload_script_map_lock.RUnlock()
-	for package_name, version := range preload_script_map {
-		dependencies = append(dependencies, types.Dependency{
-			Name:    package_name,
-			Version: version,
-		})
+	for name, requirement := range preload_script_map[profile] {
+		parsed, err := requirements.Parse(requirement)
+		if err != nil {
+			log.Warn("invalid requirement %s of the sandbox: %v", requirement, err)
+			continue
+		}
+		requested[name] = parsed
+	}
+	preload_script_map_lock.RUnlock()
+
+	for _, requirement := range listed {
+		requested[requirements.NormalizeName(requirement.Name)] = requirement
 	}
 
-	return dependencies
+	return requested
 }
@@ -0,0 +1,205 @@
+package dependencies
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python/requirements"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
+)
+
+// Distribution is a package found in an environment by its dist-info metadata
+type Distribution struct {
+	Name    string
+	Version string
+	// Requires are the Requires-Dist entries of the metadata
+	Requires []string
+	// Path is the dist-info directory relative to the root of the environment
+	Path string
+}
+
+// ReadInstalled returns the distributions installed below root by normalized name, a package
+// installed more than once is taken from below preferred, which comes first in sys.path
+func ReadInstalled(root string, preferred string) (map[string]*Distribution, error) {
+	root = filepath.Clean(root)
+	distributions := map[string]*Distribution{}
+
+	err := filepath.WalkDir(root, func(target string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".dist-info") {
+			return nil
+		}
+
+		distribution, err := readMetadata(filepath.Join(target, "METADATA"))
+		if err != nil || distribution.Name == "" {
+			// a broken installation, pip ignores it as well
+			return fs.SkipDir
+		}
+		distribution.Path = strings.TrimPrefix(target, root)
+
+		name := requirements.NormalizeName(distribution.Name)
+		existing, ok := distributions[name]
+		if !ok || (preferred != "" && !strings.HasPrefix(existing.Path, preferred) && strings.HasPrefix(distribution.Path, preferred)) {
+			distributions[name] = distribution
+		}
+		return fs.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return distributions, nil
+}
+
+// readMetadata reads the headers of a METADATA file, the description after them is skipped
+func readMetadata(path string) (*Distribution, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	distribution := &Distribution{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(key) {
+		case "name":
+			distribution.Name = value
+		case "version":
+			distribution.Version = value
+		case "requires-dist":
+			distribution.Requires = append(distribution.Requires, value)
+		}
+	}
+
+	return distribution, scanner.Err()
+}
+
+// Resolve lists the installed distributions, requested maps the normalized names of the
+// requested packages to their requirement and every package they pull in, directly or
+// transitively, is attributed to them
+func Resolve(distributions map[string]*Distribution, requested map[string]*requirements.Requirement) []types.Dependency {
+	required_by := map[string]map[string]bool{}
+
+	for name, requirement := range requested {
+		root, ok := distributions[name]
+		if !ok {
+			continue
+		}
+
+		type node struct {
+			name   string
+			extras []string
+		}
+		queue := []node{{name: name, extras: requirement.Extras}}
+		visited := map[string]bool{}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			key := current.name + "[" + strings.Join(current.extras, ",") + "]"
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			if current.name != name {
+				if required_by[current.name] == nil {
+					required_by[current.name] = map[string]bool{}
+				}
+				required_by[current.name][root.Name] = true
+			}
+
+			for _, requires := range distributions[current.name].Requires {
+				dependency, err := requirements.Parse(requires)
+				// nothing is known about the environment but the extras, requirements for other
+				// platforms or python versions are not installed anyway
+				if err != nil || !dependency.Applies(nil, current.extras) {
+					continue
+				}
+
+				dependency_name := requirements.NormalizeName(dependency.Name)
+				if _, ok := distributions[dependency_name]; ok {
+					queue = append(queue, node{name: dependency_name, extras: dependency.Extras})
+				}
+			}
+		}
+	}
+
+	dependencies := []types.Dependency{}
+	for name, distribution := range distributions {
+		dependency := types.Dependency{
+			Name:    distribution.Name,
+			Version: distribution.Version,
+		}
+		if requirement, ok := requested[name]; ok {
+			dependency.Requirement = requirement.String()
+		}
+		for requested := range required_by[name] {
+			dependency.RequiredBy = append(dependency.RequiredBy, requested)
+		}
+		sort.Strings(dependency.RequiredBy)
+		dependencies = append(dependencies, dependency)
+	}
+
+	sort.Slice(dependencies, func(i, j int) bool {
+		return requirements.NormalizeName(dependencies[i].Name) < requirements.NormalizeName(dependencies[j].Name)
+	})
+	return dependencies
+}
+
+// Diff returns the packages of a profile whose versions differ between two listings
+func Diff(profile string, before []types.Dependency, after []types.Dependency) []types.VersionChange {
+	versions := map[string]*types.VersionChange{}
+	for _, dependency := range before {
+		versions[requirements.NormalizeName(dependency.Name)] = &types.VersionChange{
+			Profile: profile,
+			Name:    dependency.Name,
+			Before:  dependency.Version,
+		}
+	}
+	for _, dependency := range after {
+		name := requirements.NormalizeName(dependency.Name)
+		if versions[name] == nil {
+			versions[name] = &types.VersionChange{Profile: profile, Name: dependency.Name}
+		}
+		versions[name].After = dependency.Version
+	}
+
+	names := make([]string, 0, len(versions))
+	for name, version := range versions {
+		if version.Before != version.After {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := make([]types.VersionChange, 0, len(names))
+	for _, name := range names {
+		changes = append(changes, *versions[name])
+	}
+	return changes
+}
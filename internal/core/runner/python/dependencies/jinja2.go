@@ -1,5 +1,7 @@
 package dependencies
 
+import "github.com/langgenius/dify-sandbox/internal/static"
+
 func init() {
-	SetupDependency("jinja2", "")
+	SetupDependency(static.DEFAULT_DEPENDENCY_PROFILE, "jinja2", "jinja2")
 }
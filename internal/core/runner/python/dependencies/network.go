@@ -1,6 +1,8 @@
 package dependencies
 
+import "github.com/langgenius/dify-sandbox/internal/static"
+
 func init() {
-	SetupDependency("httpx", "")
-	SetupDependency("requests", "")
+	SetupDependency(static.DEFAULT_DEPENDENCY_PROFILE, "httpx", "httpx")
+	SetupDependency(static.DEFAULT_DEPENDENCY_PROFILE, "requests", "requests")
 }
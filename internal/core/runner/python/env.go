@@ -1,52 +1,332 @@
 package python
 
 import (
-	_ "embed"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path"
+	"sort"
+	"sync"
 
-	"github.com/langgenius/dify-sandbox/internal/core/runner"
+	"github.com/langgenius/dify-sandbox/internal/core/chroot"
 	"github.com/langgenius/dify-sandbox/internal/static"
 	"github.com/langgenius/dify-sandbox/internal/utils/log"
 )
 
-//go:embed env.sh
-var env_script string
+const (
+	// LEGACY_MANIFEST_PATH recorded the single python chroot built in place before environments were versioned
+	LEGACY_MANIFEST_PATH = "/var/sandbox/sandbox-python.manifest.json"
 
+	// PROFILES_PATH holds the environments of dependency profiles, the default profile lives in LIB_PATH
+	PROFILES_PATH = "/var/sandbox/sandbox-python-profiles"
+	// PACKAGES_PATH holds the packages installed for dependency profiles, the default profile
+	// installs into the site-packages of python_path
+	PACKAGES_PATH = "/var/sandbox/python-packages"
+)
+
+// Env is the python chroot of a dependency profile, every build creates a new version and
+// switches new executions to it, running executions keep the version they started with
+type Env struct {
+	Profile  string
+	Versions *chroot.Versions
+
+	// packages_path is where the requirements of the profile are installed, empty for the default profile
+	packages_path string
+
+	// lock serializes builds, verifications and rollbacks
+	lock sync.Mutex
+
+	// discovered_libraries are the shared libraries extension modules need besides the lib paths
+	discovered_libraries      []string
+	discovered_libraries_lock sync.RWMutex
+
+	// built_fingerprint is the fingerprint of what the active version was built from, empty if
+	// it was not built by this process, a rollback pins the version to the fingerprint it was
+	// rolled back at so scheduled updates keep it until something changes again
+	built_fingerprint string
+}
+
+var (
+	envs      map[string]*Env
+	envs_once sync.Once
+)
+
+// loadEnvs creates the environments of the configured profiles, executions may start before the
+// first build of this process, they use the versions of the last one
+func loadEnvs() {
+	envs = map[string]*Env{
+		static.DEFAULT_DEPENDENCY_PROFILE: {
+			Profile:  static.DEFAULT_DEPENDENCY_PROFILE,
+			Versions: chroot.NewVersions(LIB_PATH),
+		},
+	}
+
+	for name := range static.GetDifySandboxGlobalConfigurations().PythonDependencyProfiles {
+		envs[name] = &Env{
+			Profile:       name,
+			Versions:      chroot.NewVersions(path.Join(PROFILES_PATH, name)),
+			packages_path: path.Join(PACKAGES_PATH, name, "site-packages"),
+		}
+	}
+
+	for _, env := range envs {
+		err := env.Versions.Load()
+		if err != nil {
+			log.Warn("failed to load the versions of python environment %s: %v", env.Profile, err)
+		}
+	}
+}
+
+// GetEnv returns the environment of a dependency profile, an empty name selects the default profile
+func GetEnv(profile string) (*Env, error) {
+	envs_once.Do(loadEnvs)
+
+	if profile == "" {
+		profile = static.DEFAULT_DEPENDENCY_PROFILE
+	}
+
+	env, ok := envs[profile]
+	if !ok {
+		return nil, fmt.Errorf("python dependency profile %s does not exist", profile)
+	}
+
+	return env, nil
+}
+
+// Envs returns the environments of all dependency profiles, sorted by name
+func Envs() []*Env {
+	envs_once.Do(loadEnvs)
+
+	list := make([]*Env, 0, len(envs))
+	for _, env := range envs {
+		list = append(list, env)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Profile < list[j].Profile
+	})
+
+	return list
+}
+
+// PreparePythonDependenciesEnv builds the environments of all dependency profiles
 func PreparePythonDependenciesEnv() error {
+	envs_once.Do(loadEnvs)
+
+	// environments of profiles which were removed from the configuration
+	entries, _ := os.ReadDir(PROFILES_PATH)
+	for _, entry := range entries {
+		if _, ok := envs[entry.Name()]; !ok {
+			log.Info("removing python chroot environment %s of a removed dependency profile", entry.Name())
+			os.RemoveAll(path.Join(PROFILES_PATH, entry.Name()))
+		}
+	}
+
+	errs := []error{}
+	for _, env := range Envs() {
+		err := env.Prepare()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("python environment %s: %w", env.Profile, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PackagesPath returns where the requirements of the profile are installed, empty for the default profile
+func (e *Env) PackagesPath() string {
+	return e.packages_path
+}
+
+// SeccompProfile returns the seccomp profile configured for the profile, empty if there is none
+func (e *Env) SeccompProfile() string {
+	return static.GetDifySandboxGlobalConfigurations().PythonDependencyProfiles[e.Profile].SeccompProfile
+}
+
+// sources returns the host paths the environment is built from
+func (e *Env) sources() []string {
 	config := static.GetDifySandboxGlobalConfigurations()
+	if e.Profile == static.DEFAULT_DEPENDENCY_PROFILE {
+		return config.PythonLibPaths
+	}
 
-	runner := runner.TempDirRunner{}
-	err := runner.WithTempDir("/", []string{}, func(root_path string) error {
-		err := os.WriteFile(path.Join(root_path, "env.sh"), []byte(env_script), 0755)
+	sources := append([]string{}, config.PythonDependencyProfiles[e.Profile].LibPaths...)
+	return append(sources, e.packages_path)
+}
+
+// Prepare builds a new version of the environment if anything changed since the active one
+func (e *Env) Prepare() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// taken before the build, changes made during it are picked up by the next one
+	fingerprint, err := e.fingerprint()
+	if err != nil {
+		log.Warn("failed to fingerprint python environment %s: %v", e.Profile, err)
+	}
+
+	err = e.prepare(nil, false)
+	if err != nil {
+		return err
+	}
+
+	e.built_fingerprint = fingerprint
+	return nil
+}
+
+func (e *Env) newBuilder(version int) *chroot.Builder {
+	builder := chroot.NewBuilder(e.Versions.Path(version), e.Versions.ManifestPath(version))
+	builder.EnableLibraryDiscovery(chroot.LibrarySearchPath())
+	return builder
+}
+
+// prepare builds a new version from the active one, files in exclude are copied from the host
+// again, a version without changes is discarded unless force is set
+func (e *Env) prepare(exclude []string, force bool) error {
+	if e.packages_path != "" {
+		// nothing may have been installed yet, the profile still gets its place in sys.path
+		err := os.MkdirAll(e.packages_path, 0755)
 		if err != nil {
 			return err
 		}
+	}
+
+	active, _ := e.Versions.Active()
+	version, err := e.Versions.Create()
+	if err != nil {
+		return err
+	}
 
-		for _, lib_path := range config.PythonLibPaths {
-			// check if the lib path is available
-			if _, err := os.Stat(lib_path); err != nil {
-				log.Warn("python lib path %s is not available", lib_path)
-				continue
-			}
-			exec_cmd := exec.Command(
-				"bash",
-				path.Join(root_path, "env.sh"),
-				lib_path,
-				LIB_PATH,
-			)
-			exec_cmd.Stderr = os.Stderr
-
-			if err := exec_cmd.Run(); err != nil {
-				return err
-			}
+	builder := e.newBuilder(version)
+	if active != 0 {
+		err = builder.Seed(e.Versions.Path(active), e.Versions.ManifestPath(active), exclude)
+		if err != nil {
+			e.Versions.Discard(version)
+			return err
 		}
+	}
 
-		os.RemoveAll(root_path)
-		os.Remove(root_path)
-		return nil
-	})
+	result, err := builder.Build(e.sources())
+	if err != nil {
+		e.Versions.Discard(version)
+		return err
+	}
+
+	err = releaseLibBinary(e.Versions.Path(version))
+	if err != nil {
+		e.Versions.Discard(version)
+		return err
+	}
+
+	for _, library := range result.Unresolved {
+		log.Warn("shared library %s needed by %s was not found on the host", library.Name, library.NeededBy)
+	}
+
+	e.discovered_libraries_lock.Lock()
+	e.discovered_libraries = result.Libraries
+	e.discovered_libraries_lock.Unlock()
+
+	changed := result.Copied != 0 || result.Removed != 0
+	if active != 0 && !changed && !force {
+		lib_changed, err := libModified(e.Versions.Path(active))
+		if err == nil && !lib_changed {
+			e.Versions.Discard(version)
+			log.Info("python chroot environment %s v%d is up to date: %d files", e.Profile, active, len(result.Manifest.Entries))
+			return nil
+		}
+	}
+
+	err = e.Versions.Activate(version)
+	if err != nil {
+		e.Versions.Discard(version)
+		return err
+	}
+	os.Remove(LEGACY_MANIFEST_PATH)
+
+	log.Info(
+		"python chroot environment %s v%d built: %d files, %d copied, %d unchanged, %d removed, %d shared libraries discovered",
+		e.Profile, version, len(result.Manifest.Entries), result.Copied, result.Unchanged, result.Removed, len(result.Libraries),
+	)
+	return nil
+}
+
+// Verify compares the active version with the manifest of its build and python.so with the
+// embedded one, with rebuild set a drifted environment is replaced right away by a new version
+// which does not take over the drifted files
+func (e *Env) Verify(rebuild bool) (*chroot.VerifyResult, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	active, _ := e.Versions.Active()
+	if active == 0 {
+		return nil, fmt.Errorf("python chroot environment %s has not been built yet", e.Profile)
+	}
+
+	lib := "/" + LIB_NAME
+	result, err := e.newBuilder(active).Verify([]string{lib})
+	if err != nil {
+		return nil, err
+	}
+
+	lib_modified, err := libModified(e.Versions.Path(active))
+	if errors.Is(err, fs.ErrNotExist) {
+		result.Deleted = append(result.Deleted, lib)
+	} else if err != nil {
+		return nil, err
+	} else if lib_modified {
+		result.Modified = append(result.Modified, lib)
+	}
+
+	if result.Intact() || !rebuild {
+		return result, nil
+	}
+
+	log.Warn("rebuilding the python chroot environment %s v%d after an integrity check failed", e.Profile, active)
+	err = e.prepare(result.Modified, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Rollback reactivates the previous version and returns it, the next scheduled update only
+// replaces it if the requirements or the installed packages change afterwards
+func (e *Env) Rollback() (int, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	fingerprint, err := e.fingerprint()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fingerprint python environment %s: %w", e.Profile, err)
+	}
+
+	version, err := e.Versions.Rollback()
+	if err != nil {
+		return 0, err
+	}
+	e.built_fingerprint = fingerprint
+
+	log.Info("python chroot environment %s rolled back to v%d", e.Profile, version)
+	return version, nil
+}
+
+// libModified reports whether python.so of an environment differs from the embedded one
+func libModified(env_path string) (bool, error) {
+	content, err := os.ReadFile(path.Join(env_path, LIB_NAME))
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(content, python_lib), nil
+}
+
+// libPaths returns the host paths the environment is built from
+func (e *Env) libPaths() []string {
+	e.discovered_libraries_lock.RLock()
+	defer e.discovered_libraries_lock.RUnlock()
 
-	return err
+	paths := append([]string{}, e.sources()...)
+	return append(paths, e.discovered_libraries...)
 }
@@ -0,0 +1,94 @@
+package python
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/langgenius/dify-sandbox/internal/core/chroot"
+)
+
+// useEnv makes env the only environment returned by Envs
+func useEnv(t *testing.T, env *Env) {
+	t.Helper()
+
+	envs_once.Do(func() {})
+	previous := envs
+	envs = map[string]*Env{env.Profile: env}
+	t.Cleanup(func() {
+		envs = previous
+	})
+}
+
+func buildVersion(t *testing.T, env *Env) int {
+	t.Helper()
+
+	version, err := env.Versions.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(env.Versions.ManifestPath(version), []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = env.Versions.Activate(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return version
+}
+
+func TestRollbackSurvivesScheduledUpdate(t *testing.T) {
+	root := t.TempDir()
+	env := &Env{
+		Profile:       "rollback",
+		Versions:      chroot.NewVersions(path.Join(root, "env")),
+		packages_path: path.Join(root, "site-packages"),
+	}
+	useEnv(t, env)
+
+	err := os.MkdirAll(path.Join(env.packages_path, "foo-1.0.dist-info"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1 := buildVersion(t, env)
+	buildVersion(t, env)
+	env.built_fingerprint, err = env.fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := env.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != v1 {
+		t.Fatalf("rolled back to v%d instead of v%d", version, v1)
+	}
+
+	// nothing changed since the rollback, the scheduled update must not replace it
+	output := &bytes.Buffer{}
+	updated, err := UpdateChangedDependencies(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 0 || !strings.Contains(output.String(), "unchanged, skipped") {
+		t.Fatalf("scheduled update after a rollback updated %d profiles: %s", updated, output)
+	}
+	if active, _ := env.Versions.Active(); active != v1 {
+		t.Fatalf("v%d is active after the scheduled update instead of v%d", active, v1)
+	}
+
+	// a package installed after the rollback is picked up again
+	err = os.MkdirAll(path.Join(env.packages_path, "bar-2.0.dist-info"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env.Changed() {
+		t.Fatal("a package installed after the rollback was not detected")
+	}
+}
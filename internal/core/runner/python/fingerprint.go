@@ -0,0 +1,109 @@
+package python
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/langgenius/dify-sandbox/internal/static"
+)
+
+// fingerprint hashes what an update of the environment depends on, the requirements of the
+// profile with their includes resolved and the packages installed in the site-packages
+// directories of the profile, the RECORD of a package lists the hash of every file it installed
+// so an upgrade or a reinstall in place changes it as well
+func (e *Env) fingerprint() (string, error) {
+	file, err := parseRequirements(e.Profile, static.GetRunnerDependencies().PythonRequirements[e.Profile])
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.New()
+	fmt.Fprintf(digest, "options\n%s\n", strings.Join(file.Options, "\n"))
+	fmt.Fprintf(digest, "constraints\n%s", formatRequirements(file.Constraints))
+	fmt.Fprintf(digest, "requirements\n%s", formatRequirements(file.Requirements))
+
+	site_packages := []string{e.packages_path}
+	if e.packages_path == "" {
+		site_packages, err = interpreterSitePackages()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, dir := range site_packages {
+		err := hashInstalled(digest, dir)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// interpreterSitePackages returns the site-packages directories of python_path, which the
+// default profile installs into
+func interpreterSitePackages() ([]string, error) {
+	output, err := exec.Command(
+		static.GetDifySandboxGlobalConfigurations().PythonPath,
+		"-c", "import site; print('\\n'.join(site.getsitepackages()))",
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the site-packages of the python interpreter: %w", err)
+	}
+
+	return strings.Fields(string(output)), nil
+}
+
+// hashInstalled adds the entries of dir to digest and the files listing what was installed for
+// the distributions among them, a missing dir has none
+func hashInstalled(digest hash.Hash, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	fmt.Fprintf(digest, "dir %s\n", dir)
+	for _, entry := range entries {
+		fmt.Fprintf(digest, "%s\n", entry.Name())
+
+		record := ""
+		if strings.HasSuffix(entry.Name(), ".dist-info") {
+			record = path.Join(dir, entry.Name(), "RECORD")
+		} else if strings.HasSuffix(entry.Name(), ".egg-info") {
+			record = path.Join(dir, entry.Name(), "installed-files.txt")
+		}
+		if record == "" || !entry.IsDir() {
+			continue
+		}
+
+		content, err := os.ReadFile(record)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Fprintf(digest, "%x\n", sha256.Sum256(content))
+	}
+
+	return nil
+}
+
+// Changed reports whether the requirements or the installed packages of the environment changed
+// since it was last built, an environment whose state is unknown counts as changed
+func (e *Env) Changed() bool {
+	fingerprint, err := e.fingerprint()
+	if err != nil {
+		return true
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.built_fingerprint != fingerprint
+}
@@ -0,0 +1,62 @@
+package python
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func writeRecord(t *testing.T, dir string, content string) {
+	t.Helper()
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(dir, "RECORD"), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFingerprintInstalledPackages(t *testing.T) {
+	env := &Env{Profile: "fingerprint", packages_path: t.TempDir()}
+
+	fingerprint := func() string {
+		t.Helper()
+
+		fingerprint, err := env.fingerprint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fingerprint
+	}
+
+	dist_info := path.Join(env.packages_path, "foo-1.0.dist-info")
+	writeRecord(t, dist_info, "foo/__init__.py,sha256=a,10\n")
+	err := os.MkdirAll(path.Join(env.packages_path, "foo"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := fingerprint()
+
+	if fingerprint() != installed {
+		t.Fatal("the fingerprint of unchanged packages changed")
+	}
+
+	// reinstalled in place, the directories stay the same but the files differ
+	writeRecord(t, dist_info, "foo/__init__.py,sha256=b,12\n")
+	reinstalled := fingerprint()
+	if reinstalled == installed {
+		t.Fatal("a package reinstalled in place was not detected")
+	}
+
+	// upgraded, only the dist-info directory is renamed
+	err = os.Rename(dist_info, path.Join(env.packages_path, "foo-1.1.dist-info"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint() == reinstalled {
+		t.Fatal("an upgraded package was not detected")
+	}
+}
@@ -0,0 +1,255 @@
+package python
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	python_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/python/dependencies"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python/requirements"
+	"github.com/langgenius/dify-sandbox/internal/static"
+)
+
+// DependencyChange is a validated change of the requirements of a dependency profile, it is
+// checked when it is requested and applied later by a background job
+type DependencyChange struct {
+	env *Env
+	// requirement is narrowed to the versions the allowlist permits, it is installed and written
+	// to the requirements file so a rebuild can not install versions the allowlist forbids, empty
+	// for removals
+	requirement *requirements.Requirement
+	// remove is the package to remove, empty for additions
+	remove string
+}
+
+// NewAddDependency validates a requirement against the allowlist for adding it to a profile
+func NewAddDependency(profile string, requirement string, hashes []string) (*DependencyChange, error) {
+	env, err := changeableEnv(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := requirements.Parse(requirement)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.URL != "" {
+		return nil, errors.New("requirements with an url can not be added at runtime")
+	}
+	parsed.Hashes = hashes
+
+	allowed, err := allowedEntries(parsed.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	reasons := []string{}
+	for _, entry := range allowed {
+		if reason := notPermitted(parsed, entry); reason != "" {
+			reasons = append(reasons, reason)
+			continue
+		}
+
+		// pip picks a version both the request and the allowlist permit
+		narrowed := *parsed
+		narrowed.Specifiers = mergeSpecifiers(parsed.Specifiers, entry.Specifiers)
+		return &DependencyChange{env: env, requirement: &narrowed}, nil
+	}
+
+	return nil, fmt.Errorf("%s is not permitted by the python dependency allowlist: %s", parsed, strings.Join(reasons, ", "))
+}
+
+// NewRemoveDependency validates removing a package which was added to a profile
+func NewRemoveDependency(profile string, name string) (*DependencyChange, error) {
+	env, err := changeableEnv(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := allowedEntries(name); err != nil {
+		return nil, err
+	}
+
+	if python_dependencies.GetDependency(env.Profile, name) != "" {
+		return nil, fmt.Errorf("%s is required by the sandbox itself", name)
+	}
+
+	content := static.GetRunnerDependencies().PythonRequirements[env.Profile]
+	if _, ok := requirements.Remove(content, name); !ok {
+		return nil, fmt.Errorf("%s is not listed in the requirements of python dependency profile %s", name, env.Profile)
+	}
+
+	return &DependencyChange{env: env, remove: name}, nil
+}
+
+// Profile returns the dependency profile the change applies to
+func (c *DependencyChange) Profile() string {
+	return c.env.Profile
+}
+
+// Apply installs or removes the package, persists the requirements of the profile and builds a
+// new version of its environment, output receives the output of pip
+func (c *DependencyChange) Apply(output io.Writer) error {
+	if c.remove != "" {
+		return c.applyRemove(output)
+	}
+
+	fmt.Fprintf(output, "installing %s\n", c.requirement.Line())
+	err := installDependencies(c.env, &requirements.File{
+		Requirements: []*requirements.Requirement{c.requirement},
+	}, output)
+	if err != nil {
+		return err
+	}
+
+	// the requirements may have changed since the change was requested
+	content := static.GetRunnerDependencies().PythonRequirements[c.env.Profile]
+	err = static.SetPythonRequirements(c.env.Profile, requirements.Set(content, c.requirement))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "added %s to %s\n", c.requirement.Line(), static.PythonRequirementsPath(c.env.Profile))
+
+	return prepareEnv(c.env, output)
+}
+
+// applyRemove uninstalls the package before it is removed from the requirements, as for additions
+// the requirements only change once pip succeeded
+func (c *DependencyChange) applyRemove(output io.Writer) error {
+	content := static.GetRunnerDependencies().PythonRequirements[c.env.Profile]
+	if _, ok := requirements.Remove(content, c.remove); !ok {
+		return fmt.Errorf("%s is not listed in the requirements anymore", c.remove)
+	}
+
+	err := uninstallPackage(c.env, c.remove, output)
+	if err != nil {
+		return err
+	}
+
+	// the requirements may have changed while pip was running
+	content = static.GetRunnerDependencies().PythonRequirements[c.env.Profile]
+	content, ok := requirements.Remove(content, c.remove)
+	if ok {
+		err = static.SetPythonRequirements(c.env.Profile, content)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "removed %s from %s\n", c.remove, static.PythonRequirementsPath(c.env.Profile))
+	}
+
+	return prepareEnv(c.env, output)
+}
+
+// uninstallPackage removes a package with pip, packages installed into the packages directory of
+// a profile are found by pip through PYTHONPATH, only the requested package is removed, not the
+// packages it pulled in
+func uninstallPackage(env *Env, name string, output io.Writer) error {
+	cmd := exec.Command("pip3", "uninstall", "-y", name)
+	if env.PackagesPath() != "" {
+		installed, err := python_dependencies.ReadInstalled(env.PackagesPath(), "")
+		if err != nil {
+			return err
+		}
+		if _, ok := installed[requirements.NormalizeName(name)]; !ok {
+			// pip would remove the package of the interpreter instead
+			fmt.Fprintf(output, "%s is not installed for profile %s\n", name, env.Profile)
+			return nil
+		}
+
+		cmd.Env = append(os.Environ(), "PYTHONPATH="+env.PackagesPath())
+	}
+
+	cmd.Stdout = output
+	cmd.Stderr = output
+	return cmd.Run()
+}
+
+// changeableEnv returns the environment of a profile if its requirements may be changed at runtime
+func changeableEnv(profile string) (*Env, error) {
+	env, err := GetEnv(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if static.GetDifySandboxGlobalConfigurations().PythonDependencyAllowlist == "" {
+		return nil, errors.New("changing python dependencies at runtime is disabled, python_dependency_allowlist is not configured")
+	}
+
+	if static.PythonRequirementsPath(env.Profile) == "" {
+		return nil, fmt.Errorf("python dependency profile %s has no requirements file to persist changes to", env.Profile)
+	}
+
+	return env, nil
+}
+
+// allowedEntries returns the entries of the allowlist for a package, the allowlist is read on
+// every change so operators can edit it without a restart
+func allowedEntries(name string) ([]*requirements.Requirement, error) {
+	path := static.GetDifySandboxGlobalConfigurations().PythonDependencyAllowlist
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the python dependency allowlist: %w", err)
+	}
+
+	allowlist, err := requirements.ParseFile(path, string(content), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid python dependency allowlist: %w", err)
+	}
+
+	entries := []*requirements.Requirement{}
+	for _, entry := range allowlist.Requirements {
+		if requirements.NormalizeName(entry.Name) == requirements.NormalizeName(name) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s is not in the python dependency allowlist", name)
+	}
+
+	return entries, nil
+}
+
+// mergeSpecifiers appends the specifiers of the allowlist which the request does not already have
+func mergeSpecifiers(requested []requirements.Specifier, allowed []requirements.Specifier) []requirements.Specifier {
+	merged := append([]requirements.Specifier{}, requested...)
+	for _, specifier := range allowed {
+		duplicate := false
+		for _, existing := range merged {
+			if existing == specifier {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, specifier)
+		}
+	}
+	return merged
+}
+
+// notPermitted returns why an allowlist entry does not permit a requirement, empty if it does,
+// pinned versions are checked right away, ranges are narrowed to the allowed versions on install
+func notPermitted(requirement *requirements.Requirement, entry *requirements.Requirement) string {
+	allowed_extras := map[string]bool{}
+	for _, extra := range entry.Extras {
+		allowed_extras[requirements.NormalizeName(extra)] = true
+	}
+	for _, extra := range requirement.Extras {
+		if !allowed_extras[requirements.NormalizeName(extra)] {
+			return fmt.Sprintf("extra %s is not allowed by %s", extra, entry)
+		}
+	}
+
+	for _, specifier := range requirement.Specifiers {
+		pinned := specifier.Operator == "===" || (specifier.Operator == "==" && !strings.HasSuffix(specifier.Version, ".*"))
+		if pinned && !entry.Contains(specifier.Version) {
+			return fmt.Sprintf("version %s is not allowed by %s", specifier.Version, entry)
+		}
+	}
+
+	return ""
+}
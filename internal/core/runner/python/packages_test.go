@@ -0,0 +1,29 @@
+package python
+
+import (
+	"testing"
+
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python/requirements"
+)
+
+func TestMergeSpecifiers(t *testing.T) {
+	requested, err := requirements.Parse("requests>=2.0,<3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := requirements.Parse("requests<3,!=2.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	narrowed := *requested
+	narrowed.Specifiers = mergeSpecifiers(requested.Specifiers, allowed.Specifiers)
+
+	// the narrowed requirement is what gets persisted, a rebuild from it stays within the allowlist
+	if line := narrowed.Line(); line != "requests>=2.0,<3,!=2.1.0" {
+		t.Fatalf("unexpected narrowed requirement %s", line)
+	}
+	if len(requested.Specifiers) != 2 {
+		t.Fatalf("the requested specifiers were modified: %v", requested.Specifiers)
+	}
+}
@@ -19,13 +19,20 @@ running_path = sys.argv[1]
 if not running_path:
     exit(-1)
 
-# get decrypt key
-key = sys.argv[2]
-if not key:
-    exit(-1)
+# the script and the untrusted code are delivered through inherited sealed memfds
+script_fd = int(sys.argv[2])
+code_fd = int(sys.argv[3])
+
+with open(code_fd, "rb", closefd=True) as code_file:
+    code = code_file.read()
+os.close(script_fd)
+
+# the script was read from /proc/self/fd, nothing can be imported from there
+del sys.path[0]
 
-from base64 import b64decode
-key = b64decode(key)
+# packages of the dependency profile, installed outside the site-packages of the interpreter
+if sys.argv[4]:
+    sys.path.insert(0, sys.argv[4])
 
 os.chdir(running_path)
 
@@ -33,15 +40,4 @@ os.chdir(running_path)
 
 lib.DifySeccomp({{uid}}, {{gid}}, {{enable_network}})
 
-code = b64decode("{{code}}")
-
-def decrypt(code, key):
-    key_len = len(key)
-    code_len = len(code)
-    code = bytearray(code)
-    for i in range(code_len):
-        code[i] = code[i] ^ key[i % key_len]
-    return bytes(code)
-
-code = decrypt(code, key)
 exec(code)
\ No newline at end of file
@@ -1,27 +1,30 @@
 package python
 
 import (
-	"crypto/rand"
 	_ "embed"
-	"encoding/base64"
 	"fmt"
 	"os"
 	"os/exec"
-	"path"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/langgenius/dify-sandbox/internal/core/runner"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
 )
 
 type PythonRunner struct {
 	runner.TempDirRunner
 }
 
+const (
+	SCRIPT_FD = 3
+	CODE_FD   = 4
+	REPORT_FD = 5
+)
+
 //go:embed prescript.py
 var sandbox_fs []byte
 
@@ -34,29 +37,83 @@ func (p *PythonRunner) Run(
 ) (chan []byte, chan []byte, chan bool, error) {
 	configuration := static.GetDifySandboxGlobalConfigurations()
 
+	env, err := GetEnv(options.DependencyProfile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the execution keeps this version even if a newer one is activated while it runs
+	env_path, release_env, err := env.Versions.Acquire()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !checkLibAvaliable(env_path) {
+		// ensure environment is reversed
+		err = releaseLibBinary(env_path)
+		if err != nil {
+			release_env()
+			return nil, nil, nil, err
+		}
+	}
+
+	// executions waiting for a uid would not finish within their timeout anyway
+	uid, gid, release_credential, err := runner.AcquireSandboxCredential(timeout)
+	if err != nil {
+		release_env()
+		return nil, nil, nil, err
+	}
+	release := func() {
+		release_credential()
+		release_env()
+	}
+
 	// initialize the environment
-	untrusted_code_path, key, err := p.InitializeEnvironment(code, preload, options)
+	script, untrusted_code, err := p.InitializeEnvironment(code, preload, uid, gid, options)
 	if err != nil {
+		release()
 		return nil, nil, nil, err
 	}
+	// the child holds its own copies once started
+	defer script.Close()
+	defer untrusted_code.Close()
 
 	// capture the output
 	output_handler := runner.NewOutputCaptureRunner()
 	output_handler.SetTimeout(timeout)
 	output_handler.SetAfterExitHook(func() {
-		// remove untrusted code
-		os.Remove(untrusted_code_path)
+		// the uid owns nothing anymore, hand it to the next execution
+		release()
 	})
 
-	// create a new process
+	report, err := runner.NewSyscallReport()
+	if err != nil {
+		release()
+		return nil, nil, nil, err
+	}
+
+	scratch, err := runner.NewScratch(uid, gid)
+	if err != nil {
+		report.Close()
+		release()
+		return nil, nil, nil, err
+	}
+
+	// create a new process, the script and the untrusted code are inherited as fd 3 and 4,
+	// blocked syscalls are reported to fd 5
 	cmd := exec.Command(
 		configuration.PythonPath,
-		untrusted_code_path,
-		LIB_PATH,
-		key,
+		fmt.Sprintf("/proc/self/fd/%d", SCRIPT_FD),
+		env_path,
+		strconv.Itoa(SCRIPT_FD),
+		strconv.Itoa(CODE_FD),
+		env.PackagesPath(),
 	)
-	cmd.Env = []string{}
-	cmd.Dir = LIB_PATH
+	cmd.ExtraFiles = []*os.File{script, untrusted_code, report.File()}
+	cmd.Env = []string{report.Env(REPORT_FD), scratch.Env()}
+	cmd.Env = append(cmd.Env, runner.LandlockEnv(env.libPaths())...)
+	cmd.Dir = env_path
+	cmd.SysProcAttr = runner.NewSandboxSysProcAttr(options)
 
 	if configuration.Proxy.Socks5 != "" {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("HTTPS_PROXY=%s", configuration.Proxy.Socks5))
@@ -70,40 +127,69 @@ func (p *PythonRunner) Run(
 		}
 	}
 
-	if len(configuration.AllowedSyscalls) > 0 {
+	if options.Learner != nil {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=1", seccomp_profile.ENV_SECCOMP_LEARN))
+	} else if len(configuration.AllowedSyscalls) > 0 {
 		cmd.Env = append(cmd.Env,
 			fmt.Sprintf("ALLOWED_SYSCALLS=%s",
 				strings.Trim(strings.Join(strings.Fields(fmt.Sprint(configuration.AllowedSyscalls)), ","), "[]"),
 			),
 		)
+	} else {
+		profile, err := seccomp_profile.Get(profileName(env, options))
+		if err != nil {
+			report.Close()
+			scratch.Remove()
+			release()
+			return nil, nil, nil, err
+		}
+		cmd.Env = append(cmd.Env, profile.Env())
 	}
 
+	output_handler.SetSyscallReport(report)
+	output_handler.SetScratch(scratch)
 	err = output_handler.CaptureOutput(cmd)
 	if err != nil {
+		release()
 		return nil, nil, nil, err
 	}
 
+	if options.Learner != nil {
+		options.Learner.Attach(cmd.Process.Pid)
+	}
+
 	return output_handler.GetStdout(), output_handler.GetStderr(), output_handler.GetDone(), nil
 }
 
-func (p *PythonRunner) InitializeEnvironment(code string, preload string, options *types.RunnerOptions) (string, string, error) {
-	if !checkLibAvaliable() {
-		// ensure environment is reversed
-		releaseLibBinary(false)
+// profileName returns the seccomp profile of an execution, a custom profile configured for the
+// dependency profile or for python3 replaces the built-in tiers
+func profileName(env *Env, options *types.RunnerOptions) string {
+	if env.SeccompProfile() != "" {
+		return env.SeccompProfile()
+	}
+
+	configuration := static.GetDifySandboxGlobalConfigurations()
+	if configuration.SeccompProfiles.Python3 != "" {
+		return configuration.SeccompProfiles.Python3
 	}
 
-	// create a tmp dir and copy the python script
-	temp_code_name := strings.ReplaceAll(uuid.New().String(), "-", "_")
-	temp_code_name = strings.ReplaceAll(temp_code_name, "/", ".")
+	tier := options.SecurityProfile
+	if tier == "" {
+		tier = configuration.SecurityProfile.Default
+	}
 
+	return seccomp_profile.SecurityProfileName("python3", tier)
+}
+
+func (p *PythonRunner) InitializeEnvironment(code string, preload string, uid int, gid int, options *types.RunnerOptions) (*os.File, *os.File, error) {
 	script := strings.Replace(
 		string(sandbox_fs),
-		"{{uid}}", strconv.Itoa(static.SANDBOX_USER_UID), 1,
+		"{{uid}}", strconv.Itoa(uid), 1,
 	)
 
 	script = strings.Replace(
 		script,
-		"{{gid}}", strconv.Itoa(static.SANDBOX_GROUP_ID), 1,
+		"{{gid}}", strconv.Itoa(gid), 1,
 	)
 
 	if options.EnableNetwork {
@@ -125,41 +211,17 @@ func (p *PythonRunner) InitializeEnvironment(code string, preload string, option
 		1,
 	)
 
-	// generate a random 512 bit key
-	key_len := 64
-	key := make([]byte, key_len)
-	_, err := rand.Read(key)
+	// nothing is written to disk, the code only lives in sealed anonymous files
+	script_file, err := runner.NewSealedMemfd("dify-sandbox-script", []byte(script))
 	if err != nil {
-		return "", "", err
-	}
-
-	// encrypt the code
-	encrypted_code := make([]byte, len(code))
-	for i := 0; i < len(code); i++ {
-		encrypted_code[i] = code[i] ^ key[i%key_len]
+		return nil, nil, err
 	}
 
-	// encode code using base64
-	code = base64.StdEncoding.EncodeToString(encrypted_code)
-	// encode key using base64
-	encoded_key := base64.StdEncoding.EncodeToString(key)
-
-	code = strings.Replace(
-		script,
-		"{{code}}",
-		code,
-		1,
-	)
-
-	untrusted_code_path := fmt.Sprintf("%s/tmp/%s.py", LIB_PATH, temp_code_name)
-	err = os.MkdirAll(path.Dir(untrusted_code_path), 0755)
-	if err != nil {
-		return "", "", err
-	}
-	err = os.WriteFile(untrusted_code_path, []byte(code), 0755)
+	code_file, err := runner.NewSealedMemfd("dify-sandbox-code", []byte(code))
 	if err != nil {
-		return "", "", err
+		script_file.Close()
+		return nil, nil, err
 	}
 
-	return untrusted_code_path, encoded_key, nil
+	return script_file, code_file, nil
 }
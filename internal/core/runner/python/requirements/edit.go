@@ -0,0 +1,77 @@
+package requirements
+
+import (
+	"strings"
+)
+
+// Set replaces the lines requesting the package of requirement in the content of a requirements
+// file by requirement, or appends it if there is none, every other line is kept as it is
+func Set(content string, requirement *Requirement) string {
+	lines, matches := matchingLines(content, requirement.Name)
+	formatted := requirement.Line()
+
+	if len(matches) == 0 {
+		content = normalizeLineEndings(content)
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content + formatted + "\n"
+	}
+
+	return splice(lines, matches, formatted)
+}
+
+// Remove removes the lines requesting a package from the content of a requirements file, it
+// reports whether there were any, requirements of included files are not touched
+func Remove(content string, name string) (string, bool) {
+	lines, matches := matchingLines(content, name)
+	if len(matches) == 0 {
+		return content, false
+	}
+
+	return splice(lines, matches, ""), true
+}
+
+// matchingLines returns the physical lines of content and the logical lines requesting a package
+func matchingLines(content string, name string) ([]string, []logicalLine) {
+	name = NormalizeName(name)
+
+	matches := []logicalLine{}
+	for _, line := range logicalLines(content) {
+		fields := strings.Fields(line.text)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+
+		end := len(fields)
+		for i, field := range fields {
+			if strings.HasPrefix(field, "-") {
+				end = i
+				break
+			}
+		}
+
+		requirement, err := Parse(strings.Join(fields[:end], " "))
+		if err == nil && NormalizeName(requirement.Name) == name {
+			matches = append(matches, line)
+		}
+	}
+
+	return strings.Split(normalizeLineEndings(content), "\n"), matches
+}
+
+// splice replaces the first of matches by replacement and drops the others
+func splice(lines []string, matches []logicalLine, replacement string) string {
+	result := []string{}
+	next := 0
+	for i, match := range matches {
+		result = append(result, lines[next:match.number-1]...)
+		if i == 0 && replacement != "" {
+			result = append(result, replacement)
+		}
+		next = match.last
+	}
+	result = append(result, lines[next:]...)
+
+	return strings.Join(result, "\n")
+}
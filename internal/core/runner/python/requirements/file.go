@@ -0,0 +1,248 @@
+package requirements
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MAX_INCLUDE_DEPTH limits nested -r and -c includes, deeper nesting is most likely a cycle
+	MAX_INCLUDE_DEPTH = 16
+	// MAX_INCLUDES limits the includes of a file altogether, a file including itself twice would
+	// otherwise be read an exponential number of times before the depth is exceeded
+	MAX_INCLUDES = 256
+)
+
+var comment_regex = regexp.MustCompile(`(^|\s)#.*$`)
+
+// File is a parsed requirements file with its includes resolved
+type File struct {
+	Requirements []*Requirement
+	// Constraints are the requirements of -c files, they restrict versions without requesting packages
+	Constraints []*Requirement
+	// Options are the global pip options of the file, e.g. --index-url https://..., as they are
+	// passed to pip
+	Options []string
+
+	includes int
+}
+
+// OpenFunc returns the content of an included requirements file
+type OpenFunc func(name string) (string, error)
+
+// options are the options pip accepts in requirements files and whether they take a value, all but
+// includes and editables are global options of the installation
+var options = map[string]bool{
+	"--requirement":     true,
+	"--constraint":      true,
+	"--editable":        true,
+	"--index-url":       true,
+	"--extra-index-url": true,
+	"--find-links":      true,
+	"--trusted-host":    true,
+	"--only-binary":     true,
+	"--no-binary":       true,
+	"--no-index":        false,
+	"--pre":             false,
+	"--prefer-binary":   false,
+	"--require-hashes":  false,
+}
+
+var short_options = map[string]string{
+	"-r": "--requirement",
+	"-c": "--constraint",
+	"-e": "--editable",
+	"-i": "--index-url",
+	"-f": "--find-links",
+}
+
+// ParseFile parses a requirements file as pip reads it, includes are read with open relative to
+// the file including them, a nil open rejects them
+func ParseFile(name string, content string, open OpenFunc) (*File, error) {
+	file := &File{}
+	err := file.parse(name, content, open, false, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (f *File) parse(name string, content string, open OpenFunc, constraints bool, depth int) error {
+	if depth > MAX_INCLUDE_DEPTH {
+		return fmt.Errorf("%s: requirements files are nested more than %d levels deep", name, MAX_INCLUDE_DEPTH)
+	}
+
+	for _, line := range logicalLines(content) {
+		err := f.parseLine(name, line.text, open, constraints, depth)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line.number, err)
+		}
+	}
+
+	return nil
+}
+
+func (f *File) parseLine(name string, line string, open OpenFunc, constraints bool, depth int) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if strings.HasPrefix(fields[0], "-") {
+		option, value, err := parseOption(fields)
+		if err != nil {
+			return err
+		}
+
+		switch option {
+		case "--requirement", "--constraint":
+			if open == nil {
+				return fmt.Errorf("%s %s: including requirements files is not allowed here", option, value)
+			}
+
+			f.includes++
+			if f.includes > MAX_INCLUDES {
+				return fmt.Errorf("more than %d requirements files are included", MAX_INCLUDES)
+			}
+
+			include := value
+			if !path.IsAbs(include) {
+				include = path.Join(path.Dir(name), include)
+			}
+			content, err := open(include)
+			if err != nil {
+				return err
+			}
+			// requirements of a constraints file stay constraints
+			return f.parse(include, content, open, constraints || option == "--constraint", depth+1)
+		case "--editable":
+			return errors.New("editable requirements are not supported")
+		}
+
+		if value != "" {
+			option += " " + value
+		}
+		f.Options = append(f.Options, option)
+		return nil
+	}
+
+	// the requirement ends where its options start, like pip splits them
+	end := len(fields)
+	for i, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			end = i
+			break
+		}
+	}
+
+	requirement, err := Parse(strings.Join(fields[:end], " "))
+	if err != nil {
+		return err
+	}
+
+	for i := end; i < len(fields); i++ {
+		hash, ok := strings.CutPrefix(fields[i], "--hash=")
+		if !ok && fields[i] == "--hash" && i+1 < len(fields) {
+			i++
+			hash, ok = fields[i], true
+		}
+		if !ok || hash == "" {
+			return fmt.Errorf("unsupported option %s of requirement %s", fields[i], requirement.Name)
+		}
+		requirement.Hashes = append(requirement.Hashes, hash)
+	}
+
+	if constraints {
+		f.Constraints = append(f.Constraints, requirement)
+	} else {
+		f.Requirements = append(f.Requirements, requirement)
+	}
+	return nil
+}
+
+// parseOption returns the long name and the value of the option of a line, e.g. -rbase.txt and
+// --requirement=base.txt are both --requirement base.txt
+func parseOption(fields []string) (string, string, error) {
+	name, value, has_value := strings.Cut(fields[0], "=")
+	if !strings.HasPrefix(name, "--") {
+		// -r base.txt or -rbase.txt
+		if len(fields[0]) < 2 {
+			return "", "", fmt.Errorf("unsupported option %s", fields[0])
+		}
+		name, value, has_value = fields[0][:2], fields[0][2:], len(fields[0]) > 2
+		long, ok := short_options[name]
+		if !ok {
+			return "", "", fmt.Errorf("unsupported option %s", fields[0])
+		}
+		name = long
+	}
+
+	takes_value, ok := options[name]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported option %s", name)
+	}
+
+	rest := fields[1:]
+	if takes_value && !has_value {
+		if len(rest) == 0 {
+			return "", "", fmt.Errorf("option %s requires a value", name)
+		}
+		value, rest = rest[0], rest[1:]
+	} else if !takes_value && has_value {
+		return "", "", fmt.Errorf("option %s does not take a value", name)
+	}
+
+	if len(rest) > 0 {
+		return "", "", fmt.Errorf("unexpected %s after option %s", strings.Join(rest, " "), name)
+	}
+
+	return name, value, nil
+}
+
+type logicalLine struct {
+	// number is the line the logical line starts at, last the one it ends at
+	number int
+	last   int
+	text   string
+}
+
+func normalizeLineEndings(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.ReplaceAll(content, "\r", "\n")
+}
+
+// logicalLines joins lines continued with a backslash and removes comments
+func logicalLines(content string) []logicalLine {
+	content = normalizeLineEndings(content)
+
+	lines := []logicalLine{}
+	var current *logicalLine
+	for i, text := range strings.Split(content, "\n") {
+		if current == nil {
+			current = &logicalLine{number: i + 1}
+		}
+
+		if continued, ok := strings.CutSuffix(text, "\\"); ok && !comment_regex.MatchString(text) {
+			current.text += continued + " "
+			continue
+		}
+
+		current.text += text
+		current.text = strings.TrimSpace(comment_regex.ReplaceAllString(current.text, ""))
+		current.last = i + 1
+		lines = append(lines, *current)
+		current = nil
+	}
+
+	if current != nil {
+		current.last = strings.Count(content, "\n") + 1
+		current.text = strings.TrimSpace(comment_regex.ReplaceAllString(current.text, ""))
+		lines = append(lines, *current)
+	}
+
+	return lines
+}
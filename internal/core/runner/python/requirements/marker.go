@@ -0,0 +1,272 @@
+package requirements
+
+import (
+	"strings"
+)
+
+// MARKER_VARIABLES are the environment variables a marker may refer to
+var MARKER_VARIABLES = []string{
+	"python_version", "python_full_version", "os_name", "sys_platform", "platform_release",
+	"platform_system", "platform_version", "platform_machine", "platform_python_implementation",
+	"implementation_name", "implementation_version", "extra",
+}
+
+// Marker is the environment marker of a requirement, e.g. python_version < "3.8" and extra == "socks"
+type Marker interface {
+	// Evaluate reports whether the marker matches an environment, comparisons with variables
+	// missing from env are assumed to match, nothing is known about them
+	Evaluate(env map[string]string) bool
+	String() string
+}
+
+type markerOr struct {
+	markers []Marker
+}
+
+func (m *markerOr) Evaluate(env map[string]string) bool {
+	for _, marker := range m.markers {
+		if marker.Evaluate(env) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *markerOr) String() string {
+	markers := make([]string, 0, len(m.markers))
+	for _, marker := range m.markers {
+		markers = append(markers, marker.String())
+	}
+	return strings.Join(markers, " or ")
+}
+
+type markerAnd struct {
+	markers []Marker
+}
+
+func (m *markerAnd) Evaluate(env map[string]string) bool {
+	for _, marker := range m.markers {
+		if !marker.Evaluate(env) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *markerAnd) String() string {
+	markers := make([]string, 0, len(m.markers))
+	for _, marker := range m.markers {
+		if _, ok := marker.(*markerOr); ok {
+			markers = append(markers, "("+marker.String()+")")
+		} else {
+			markers = append(markers, marker.String())
+		}
+	}
+	return strings.Join(markers, " and ")
+}
+
+// markerValue is either a variable or a quoted string
+type markerValue struct {
+	variable string
+	literal  string
+}
+
+func (v markerValue) resolve(env map[string]string) (string, bool) {
+	if v.variable == "" {
+		return v.literal, true
+	}
+
+	value, ok := env[v.variable]
+	return value, ok
+}
+
+func (v markerValue) String() string {
+	if v.variable != "" {
+		return v.variable
+	}
+	if strings.Contains(v.literal, `"`) {
+		return "'" + v.literal + "'"
+	}
+	return `"` + v.literal + `"`
+}
+
+type markerCompare struct {
+	left     markerValue
+	operator string
+	right    markerValue
+}
+
+func (m *markerCompare) Evaluate(env map[string]string) bool {
+	left, ok := m.left.resolve(env)
+	if !ok {
+		return true
+	}
+	right, ok := m.right.resolve(env)
+	if !ok {
+		return true
+	}
+
+	if m.left.variable == "extra" || m.right.variable == "extra" {
+		left, right = NormalizeName(left), NormalizeName(right)
+	}
+
+	switch m.operator {
+	case "in":
+		return strings.Contains(right, left)
+	case "not in":
+		return !strings.Contains(right, left)
+	}
+
+	// versions are compared as versions, anything else as strings, markers compare pre-releases
+	// of the environment like any other version
+	specifier := Specifier{Operator: m.operator, Version: right}
+	if _, ok := parseVersion(left); ok && specifier.validate() == nil {
+		return specifier.matches(left)
+	}
+
+	comparison := strings.Compare(left, right)
+	switch m.operator {
+	case "==", "===":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	}
+
+	// ~= is only defined for versions
+	return false
+}
+
+func (m *markerCompare) String() string {
+	return m.left.String() + " " + m.operator + " " + m.right.String()
+}
+
+func (p *parser) markerOr() (Marker, error) {
+	markers := []Marker{}
+	for {
+		marker, err := p.markerAnd()
+		if err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+
+		p.skipSpace()
+		if !p.keyword("or") {
+			break
+		}
+	}
+
+	if len(markers) == 1 {
+		return markers[0], nil
+	}
+	return &markerOr{markers: markers}, nil
+}
+
+func (p *parser) markerAnd() (Marker, error) {
+	markers := []Marker{}
+	for {
+		marker, err := p.markerExpression()
+		if err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+
+		p.skipSpace()
+		if !p.keyword("and") {
+			break
+		}
+	}
+
+	if len(markers) == 1 {
+		return markers[0], nil
+	}
+	return &markerAnd{markers: markers}, nil
+}
+
+func (p *parser) markerExpression() (Marker, error) {
+	p.skipSpace()
+	if p.consume("(") {
+		marker, err := p.markerOr()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected ) in marker")
+		}
+		return marker, nil
+	}
+
+	left, err := p.markerValue()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	operator := p.markerOperator()
+	if operator == "" {
+		return nil, p.errorf("expected a marker operator")
+	}
+
+	p.skipSpace()
+	right, err := p.markerValue()
+	if err != nil {
+		return nil, err
+	}
+
+	return &markerCompare{left: left, operator: operator, right: right}, nil
+}
+
+func (p *parser) markerValue() (markerValue, error) {
+	quote := p.peek()
+	if quote == '"' || quote == '\'' {
+		p.pos++
+		end := strings.IndexByte(p.input[p.pos:], quote)
+		if end < 0 {
+			return markerValue{}, p.errorf("unterminated string in marker")
+		}
+
+		literal := p.input[p.pos : p.pos+end]
+		p.pos += end + 1
+		return markerValue{literal: literal}, nil
+	}
+
+	for _, variable := range MARKER_VARIABLES {
+		if p.keyword(variable) {
+			return markerValue{variable: variable}, nil
+		}
+	}
+
+	return markerValue{}, p.errorf("expected a marker variable or a quoted string")
+}
+
+func (p *parser) markerOperator() string {
+	for _, operator := range []string{"===", "==", "!=", "<=", ">=", "~=", "<", ">"} {
+		if p.consume(operator) {
+			return operator
+		}
+	}
+
+	if p.keyword("in") {
+		return "in"
+	}
+
+	start := p.pos
+	if p.keyword("not") {
+		p.skipSpace()
+		if p.keyword("in") {
+			return "not in"
+		}
+	}
+	p.pos = start
+
+	return ""
+}
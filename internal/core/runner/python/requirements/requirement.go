@@ -0,0 +1,359 @@
+package requirements
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var normalize_regex = regexp.MustCompile(`[-_.]+`)
+
+// Requirement is a dependency specification as defined by PEP 508, e.g.
+// httpx[socks]>=0.24,<1 ; python_version >= "3.8"
+type Requirement struct {
+	Name   string
+	Extras []string
+	// Specifiers restrict the version, all of them have to match
+	Specifiers []Specifier
+	// URL is set instead of Specifiers for name @ url requirements
+	URL string
+	// Marker is nil if the requirement applies to every environment
+	Marker Marker
+	// Hashes are the --hash options of the requirement in a requirements file
+	Hashes []string
+}
+
+// NormalizeName returns the name of a package as pip compares it, e.g. Jinja2 and jinja2 are the same
+func NormalizeName(name string) string {
+	return normalize_regex.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// Parse parses a single requirement without the options of a requirements file
+func Parse(requirement string) (*Requirement, error) {
+	p := &parser{input: requirement}
+	r := &Requirement{}
+
+	p.skipSpace()
+	r.Name = p.identifier()
+	if r.Name == "" {
+		return nil, p.errorf("expected a package name")
+	}
+
+	p.skipSpace()
+	if p.peek() == '[' {
+		extras, err := p.extras()
+		if err != nil {
+			return nil, err
+		}
+		r.Extras = extras
+	}
+
+	p.skipSpace()
+	if p.peek() == '@' {
+		p.pos++
+		p.skipSpace()
+		// ; belongs to the url unless whitespace separates it
+		start := p.pos
+		for !p.atEnd() && !isSpace(p.peek()) {
+			p.pos++
+		}
+		r.URL = p.input[start:p.pos]
+		if r.URL == "" {
+			return nil, p.errorf("expected an url")
+		}
+	} else {
+		specifiers, err := p.versionSpec()
+		if err != nil {
+			return nil, err
+		}
+		r.Specifiers = specifiers
+	}
+
+	p.skipSpace()
+	if p.peek() == ';' {
+		p.pos++
+		marker, err := p.markerOr()
+		if err != nil {
+			return nil, err
+		}
+		r.Marker = marker
+	}
+
+	p.skipSpace()
+	if !p.atEnd() {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+
+	return r, nil
+}
+
+// String formats the requirement as PEP 508 specifies it, without hashes
+func (r *Requirement) String() string {
+	var builder strings.Builder
+	builder.WriteString(r.Name)
+	if len(r.Extras) > 0 {
+		builder.WriteString("[" + strings.Join(r.Extras, ",") + "]")
+	}
+
+	if r.URL != "" {
+		builder.WriteString(" @ " + r.URL)
+	} else {
+		specifiers := make([]string, 0, len(r.Specifiers))
+		for _, specifier := range r.Specifiers {
+			specifiers = append(specifiers, specifier.String())
+		}
+		builder.WriteString(strings.Join(specifiers, ","))
+	}
+
+	if r.Marker != nil {
+		// the space keeps the marker apart from an url
+		builder.WriteString(" ; " + r.Marker.String())
+	}
+
+	return builder.String()
+}
+
+// Line formats the requirement with its hashes as a line of a requirements file
+func (r *Requirement) Line() string {
+	line := r.String()
+	for _, hash := range r.Hashes {
+		line += " --hash=" + hash
+	}
+	return line
+}
+
+// Contains reports whether a version satisfies every specifier of the requirement, pre-releases
+// only do if one of the specifiers names a pre-release, as in PEP 440
+func (r *Requirement) Contains(version string) bool {
+	if isPrerelease(version) && !r.allowsPrereleases() {
+		return false
+	}
+
+	return r.matches(version)
+}
+
+// Filter returns the versions which satisfy the requirement, pre-releases are only returned if
+// one of the specifiers names a pre-release or no final release satisfies the requirement
+func (r *Requirement) Filter(versions []string) []string {
+	releases := []string{}
+	prereleases := []string{}
+	for _, version := range versions {
+		if !r.matches(version) {
+			continue
+		}
+
+		if isPrerelease(version) && !r.allowsPrereleases() {
+			prereleases = append(prereleases, version)
+		} else {
+			releases = append(releases, version)
+		}
+	}
+
+	if len(releases) == 0 {
+		return prereleases
+	}
+	return releases
+}
+
+func (r *Requirement) allowsPrereleases() bool {
+	for _, specifier := range r.Specifiers {
+		if specifier.allowsPrereleases() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches reports whether a version satisfies every specifier regardless of pre-releases
+func (r *Requirement) matches(version string) bool {
+	for _, specifier := range r.Specifiers {
+		if !specifier.matches(version) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Applies reports whether the requirement applies to an environment installed with extras, see
+// Marker.Evaluate for variables missing from env
+func (r *Requirement) Applies(env map[string]string, extras []string) bool {
+	if r.Marker == nil {
+		return true
+	}
+
+	values := map[string]string{}
+	for name, value := range env {
+		values[name] = value
+	}
+
+	for _, extra := range append([]string{""}, extras...) {
+		values["extra"] = extra
+		if r.Marker.Evaluate(values) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid requirement %q at %d: %s", p.input, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) atEnd() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() byte {
+	if p.atEnd() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.atEnd() && isSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// consume skips token if the input continues with it
+func (p *parser) consume(token string) bool {
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// keyword skips word if the input continues with it as a whole word
+func (p *parser) keyword(word string) bool {
+	rest := p.input[p.pos:]
+	if !strings.HasPrefix(rest, word) || (len(rest) > len(word) && isIdentifier(rest[len(word)])) {
+		return false
+	}
+
+	p.pos += len(word)
+	return true
+}
+
+// identifier reads a name or an extra, letters and digits, with . - _ in between
+func (p *parser) identifier() string {
+	start := p.pos
+	if !isAlphanumeric(p.peek()) {
+		return ""
+	}
+
+	for !p.atEnd() && isIdentifier(p.peek()) {
+		p.pos++
+	}
+	// a name must end with a letter or a digit
+	for p.pos > start+1 && !isAlphanumeric(p.input[p.pos-1]) {
+		p.pos--
+	}
+
+	return p.input[start:p.pos]
+}
+
+func (p *parser) extras() ([]string, error) {
+	p.pos++ // [
+	extras := []string{}
+
+	p.skipSpace()
+	if p.consume("]") {
+		return extras, nil
+	}
+
+	for {
+		p.skipSpace()
+		extra := p.identifier()
+		if extra == "" {
+			return nil, p.errorf("expected an extra")
+		}
+		extras = append(extras, extra)
+
+		p.skipSpace()
+		if p.consume("]") {
+			return extras, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or ] after extra")
+		}
+	}
+}
+
+// versionSpec reads the specifiers, optionally in parentheses as older packages write them
+func (p *parser) versionSpec() ([]Specifier, error) {
+	parenthesized := p.consume("(")
+
+	specifiers := []Specifier{}
+	for {
+		p.skipSpace()
+		operator := p.versionOperator()
+		if operator == "" {
+			if len(specifiers) > 0 {
+				return nil, p.errorf("expected a version operator after ,")
+			}
+			break
+		}
+
+		p.skipSpace()
+		start := p.pos
+		for !p.atEnd() && isVersion(p.peek()) {
+			p.pos++
+		}
+
+		specifier := Specifier{Operator: operator, Version: p.input[start:p.pos]}
+		err := specifier.validate()
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		specifiers = append(specifiers, specifier)
+
+		p.skipSpace()
+		if !p.consume(",") {
+			break
+		}
+	}
+
+	if parenthesized {
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected )")
+		}
+	}
+
+	return specifiers, nil
+}
+
+func (p *parser) versionOperator() string {
+	for _, operator := range []string{"===", "~=", "==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isIdentifier(c byte) bool {
+	return isAlphanumeric(c) || c == '-' || c == '_' || c == '.'
+}
+
+func isVersion(c byte) bool {
+	return isAlphanumeric(c) || strings.IndexByte("-_.*+!", c) >= 0
+}
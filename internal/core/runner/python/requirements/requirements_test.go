@@ -0,0 +1,314 @@
+package requirements
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var requirement_seeds = []string{
+	"requests",
+	"requests==2.31.0",
+	"httpx[socks] >=0.24, <1",
+	"Jinja2 (>=3.0,!=3.1.0)",
+	"numpy~=1.26.0 ; python_version >= \"3.9\" and platform_machine != 'arm64'",
+	"pip @ https://example.com/pip-23.0.1-py3-none-any.whl ; sys_platform == \"linux\"",
+	"pkg[a,b]==1.* ; (os_name == \"posix\" or os_name == \"nt\") and extra == \"test\"",
+	"pkg===1.0-local",
+	"pkg ; 'linux' in sys_platform",
+	"pkg ; python_version not in '2.7 3.5'",
+	"zope.interface>=5.0.post1,<6.0rc1",
+}
+
+func TestParse(t *testing.T) {
+	for requirement, expected := range map[string]string{
+		"requests":                                 "requests",
+		"httpx[socks] >=0.24, <1":                  "httpx[socks]>=0.24,<1",
+		"Jinja2 (>=3.0,!=3.1.0)":                   "Jinja2>=3.0,!=3.1.0",
+		"a;python_version<'3.8'or(b_c)":            "",
+		"name @ https://x/y.whl;os_name":           "name @ https://x/y.whl;os_name",
+		"name @ https://x/y.whl ; os_name == 'nt'": "name @ https://x/y.whl ; os_name == \"nt\"",
+		"pkg[a, b]==1.* ; extra == 'A'":            "pkg[a,b]==1.* ; extra == \"A\"",
+		"pkg>=1.*":                                 "",
+		"pkg~=1":                                   "",
+		"-pkg":                                     "",
+		"pkg-":                                     "",
+		"pkg ; python_version < '3.8' or":          "",
+	} {
+		r, err := Parse(requirement)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("%q was accepted as %q", requirement, r)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q was rejected: %v", requirement, err)
+		} else if r.String() != expected {
+			t.Errorf("%q was parsed as %q, expected %q", requirement, r, expected)
+		}
+	}
+}
+
+func TestSpecifierContains(t *testing.T) {
+	for requirement, versions := range map[string]string{
+		"pkg>=1.0,<2":   "1.0 1.5 1.9.9 1.0.post1 -0.9 -2.0 -2.0rc1 -1.0rc1",
+		"pkg==1.4.*":    "1.4 1.4.0 1.4.9 -1.5 -1.40",
+		"pkg~=1.4.2":    "1.4.2 1.4.10 -1.5.0 -1.4.1",
+		"pkg!=1.0":      "1.0.1 0.9 -1.0 -1.0.0",
+		"pkg>1.0.dev1":  "1.0a1 1.0 -1.0.dev0",
+		"pkg>1.0":       "1.1 -1.0.post1",
+		"pkg===1.0+abc": "1.0+abc -1.0",
+		"pkg<=2!1.0":    "1!5.0 2!1.0 -2!1.1",
+		"pkg<=1.0rc5":   "1.0rc1 1.0rc5 1.0b10 1.0.dev3 -1.0rc10 -1.0",
+		"pkg>=1.0.dev2": "1.0.dev10 1.0a1 1.0 -1.0.dev1 -1.0.dev",
+		"pkg<1.0.post2": "1.0.post1 1.0-1 -0.9rc1 -1.0.post10 -1.0rc1 -1.0.post2.dev1",
+		"pkg>1.0a2":     "1.0a10 1.0b1 1.0rc1 1.0 -1.0a1 -1.0.dev5",
+		// pre-releases are excluded unless a specifier names one
+		"pkg>=1.0":      "1.0 1.1 1.1.post1 -1.1a1 -1.1.dev1 -2.0rc1",
+		"pkg":           "1.0 -1.0a1",
+		"pkg>=1.0a1,<2": "1.0 1.5a1 1.0a1 -2.0a1",
+		"pkg==1.1a1":    "1.1a1 -1.1",
+		"pkg!=1.1a1":    "1.0 -1.1a1 -1.2a1",
+		"pkg===1.1a1":   "1.1a1 -1.1a2",
+		"pkg~=1.0":      "1.0 1.9 -1.9rc1",
+	} {
+		r, err := Parse(requirement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, version := range strings.Fields(versions) {
+			expected := !strings.HasPrefix(version, "-")
+			version = strings.TrimPrefix(version, "-")
+			if r.Contains(version) != expected {
+				t.Errorf("%s contains %s: %v, expected %v", requirement, version, !expected, expected)
+			}
+		}
+	}
+}
+
+func TestRequirementFilter(t *testing.T) {
+	for requirement, expected := range map[string]map[string]string{
+		"pkg>=1.0": {
+			"0.9 1.0 1.1a1 1.1": "1.0 1.1",
+			// pre-releases are picked if they are the only candidates
+			"0.9 1.1a1 1.2rc1": "1.1a1 1.2rc1",
+			"0.9 0.9rc1":       "",
+		},
+		"pkg>=1.0a1": {
+			"0.9 1.0 1.1a1": "1.0 1.1a1",
+		},
+	} {
+		r, err := Parse(requirement)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for versions, filtered := range expected {
+			if result := strings.Join(r.Filter(strings.Fields(versions)), " "); result != filtered {
+				t.Errorf("%s filters %s to %q, expected %q", requirement, versions, result, filtered)
+			}
+		}
+	}
+}
+
+func TestMarkerEvaluate(t *testing.T) {
+	r, err := Parse(`pkg ; (python_version >= "3.8" and sys_platform == "linux") or extra == "Socks"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for env, expected := range map[string]bool{
+		"python_version=3.10 sys_platform=linux": true,
+		"python_version=3.7 sys_platform=linux":  false,
+		"python_version=3.10 sys_platform=win32": false,
+		"python_version=3.7 extra=socks":         true,
+		"sys_platform=linux":                     true,
+	} {
+		values := map[string]string{"extra": ""}
+		for _, field := range strings.Fields(env) {
+			name, value, _ := strings.Cut(field, "=")
+			values[name] = value
+		}
+
+		if r.Marker.Evaluate(values) != expected {
+			t.Errorf("marker %s evaluated to %v for %s", r.Marker, !expected, env)
+		}
+	}
+
+	// markers compare the pre-releases of the interpreter like any other version
+	if !r.Marker.Evaluate(map[string]string{"python_version": "3.13.0rc1", "sys_platform": "linux", "extra": ""}) {
+		t.Errorf("marker %s does not apply to a pre-release of python", r.Marker)
+	}
+
+	if !r.Applies(map[string]string{"python_version": "3.7", "sys_platform": "linux"}, []string{"socks"}) {
+		t.Errorf("marker %s does not apply with the extra socks", r.Marker)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	files := map[string]string{
+		"dependencies/base.txt":        "-c constraints.txt\nhttpx[socks]>=0.24 # network\n",
+		"dependencies/constraints.txt": "idna<4\n",
+	}
+	open := func(name string) (string, error) {
+		content, ok := files[name]
+		if !ok {
+			return "", fmt.Errorf("%s does not exist", name)
+		}
+		return content, nil
+	}
+
+	file, err := ParseFile("dependencies/python-requirements.txt", strings.Join([]string{
+		"# comment",
+		"--index-url=https://pypi.org/simple",
+		"-rbase.txt",
+		"requests==2.31.0 \\",
+		"    --hash=sha256:aaaa \\",
+		"    --hash sha256:bbbb",
+		"pip @ https://example.com/pip.whl#sha256=cccc",
+		"",
+	}, "\r\n"), open)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := fmt.Sprint(file.Options, file.Requirements, file.Constraints, file.Requirements[1].Hashes)
+	expected := "[--index-url https://pypi.org/simple] [httpx[socks]>=0.24 requests==2.31.0 pip @ https://example.com/pip.whl#sha256=cccc] [idna<4] [sha256:aaaa sha256:bbbb]"
+	if result != expected {
+		t.Fatalf("unexpected result %s, expected %s", result, expected)
+	}
+
+	for content, message := range map[string]string{
+		"-r missing.txt":           "missing.txt does not exist",
+		"-e .":                     "editable requirements are not supported",
+		"\n\npkg --install-option": "requirements.txt:3: unsupported option --install-option",
+		"--no-index yes":           "unexpected yes after option --no-index",
+		"-x":                       "unsupported option -x",
+	} {
+		_, err := ParseFile("requirements.txt", content, open)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q failed with %v, expected %s", content, err, message)
+		}
+	}
+
+	_, err = ParseFile("requirements.txt", "-r requirements.txt", func(name string) (string, error) {
+		return "-r requirements.txt", nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "nested more than") {
+		t.Errorf("a cycle of includes failed with %v", err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	content := strings.Join([]string{
+		"# sandbox",
+		"requests==2.31.0 \\",
+		"    --hash=sha256:aaaa",
+		"Jinja2>=3 # templates",
+		"-r base.txt",
+		"jinja2<4",
+	}, "\r\n")
+
+	r, err := Parse("jinja2==3.1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Hashes = []string{"sha256:bbbb"}
+
+	content = Set(content, r)
+	expected := "# sandbox\nrequests==2.31.0 \\\n    --hash=sha256:aaaa\njinja2==3.1.2 --hash=sha256:bbbb\n-r base.txt"
+	if content != expected {
+		t.Fatalf("unexpected content after setting jinja2:\n%s", content)
+	}
+
+	r, err = Parse("httpx[socks]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content = Set(content, r)
+
+	content, ok := Remove(content, "Requests")
+	if !ok {
+		t.Fatal("requests was not removed")
+	}
+	expected = "# sandbox\njinja2==3.1.2 --hash=sha256:bbbb\n-r base.txt\nhttpx[socks]\n"
+	if content != expected {
+		t.Fatalf("unexpected content after removing requests:\n%s", content)
+	}
+
+	if _, ok := Remove(content, "base"); ok {
+		t.Fatal("an include was removed")
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range requirement_seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, requirement string) {
+		r, err := Parse(requirement)
+		if err != nil {
+			return
+		}
+
+		// formatting must not change what was parsed
+		formatted := r.String()
+		again, err := Parse(formatted)
+		if err != nil {
+			t.Fatalf("%q was formatted as %q which is rejected: %v", requirement, formatted, err)
+		}
+		if again.String() != formatted {
+			t.Fatalf("%q was formatted as %q and then as %q", requirement, formatted, again)
+		}
+
+		r.Contains("1.0")
+		r.Applies(map[string]string{"python_version": "3.10"}, []string{"test"})
+	})
+}
+
+func FuzzParseFile(f *testing.F) {
+	f.Add("requests==2.31.0 \\\n    --hash=sha256:aaaa # pinned\n-r other.txt\n")
+	f.Add("-c constraints.txt\n--index-url https://pypi.org/simple\n--no-index\n")
+	f.Add(strings.Join(requirement_seeds, "\n"))
+
+	f.Fuzz(func(t *testing.T, content string) {
+		// includes resolve to the file itself until they are nested too deep
+		file, err := ParseFile("requirements.txt", content, func(name string) (string, error) {
+			return content, nil
+		})
+		if err != nil {
+			return
+		}
+
+		for _, r := range append(file.Requirements, file.Constraints...) {
+			if _, err := Parse(r.String()); err != nil {
+				t.Fatalf("%q was formatted as %q which is rejected: %v", content, r, err)
+			}
+		}
+	})
+}
+
+func FuzzCompareVersions(f *testing.F) {
+	f.Add("1.0", "1.0.0")
+	f.Add("1.0rc1", "1.0.post1")
+	f.Add("1!0.1", "2.0.dev3")
+
+	f.Fuzz(func(t *testing.T, a string, b string) {
+		first, ok := parseVersion(a)
+		if !ok {
+			return
+		}
+		second, ok := parseVersion(b)
+		if !ok {
+			return
+		}
+
+		if compareVersions(first, second) != -compareVersions(second, first) {
+			t.Fatalf("comparing %q and %q is not antisymmetric", a, b)
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package requirements
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Specifier is a single version clause of a requirement, e.g. >=2.0 or ==1.4.*
+type Specifier struct {
+	Operator string
+	Version  string
+}
+
+func (s Specifier) String() string {
+	return s.Operator + s.Version
+}
+
+func (s Specifier) validate() error {
+	if s.Version == "" {
+		return errors.New("expected a version")
+	}
+
+	if s.Operator == "===" {
+		// arbitrary equality compares strings, anything goes
+		return nil
+	}
+
+	wildcard := strings.Index(s.Version, "*")
+	if wildcard >= 0 {
+		if s.Operator != "==" && s.Operator != "!=" {
+			return errors.New("a wildcard is only allowed with == and !=")
+		}
+		if wildcard != len(s.Version)-1 || !strings.HasSuffix(s.Version, ".*") {
+			return errors.New("a wildcard must end the version as .*")
+		}
+	}
+
+	if _, ok := parseVersion(strings.TrimSuffix(s.Version, ".*")); !ok {
+		return errors.New("invalid version " + s.Version)
+	}
+	if s.Operator == "~=" && len(mustParseVersion(s.Version).release) < 2 {
+		return errors.New("~= requires at least two release segments")
+	}
+
+	return nil
+}
+
+// Contains reports whether a version satisfies the specifier, versions are compared by their
+// release segments and then by the numbers of their pre-, post- and dev-release, as in PEP 440
+//
+// pre-releases only satisfy a specifier which names a pre-release itself, >=1.0 excludes 1.1a1
+func (s Specifier) Contains(version string) bool {
+	if isPrerelease(version) && !s.allowsPrereleases() {
+		return false
+	}
+
+	return s.matches(version)
+}
+
+// allowsPrereleases reports whether the specifier explicitly asks for pre-releases, != never does
+func (s Specifier) allowsPrereleases() bool {
+	if s.Operator == "!=" {
+		return false
+	}
+
+	specified, ok := parseVersion(strings.TrimSuffix(s.Version, ".*"))
+	return ok && specified.isPrerelease()
+}
+
+// isPrerelease reports whether a version is a pre- or dev-release, invalid versions are not
+func isPrerelease(value string) bool {
+	v, ok := parseVersion(value)
+	return ok && v.isPrerelease()
+}
+
+// matches compares a version with the specifier regardless of whether it is a pre-release
+func (s Specifier) matches(version string) bool {
+	if s.Operator == "===" {
+		return version == s.Version
+	}
+
+	candidate, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+
+	if prefix, ok := strings.CutSuffix(s.Version, ".*"); ok {
+		matches := hasPrefix(candidate.release, mustParseVersion(prefix).release)
+		return matches == (s.Operator == "==")
+	}
+
+	specified, ok := parseVersion(s.Version)
+	if !ok {
+		return false
+	}
+
+	comparison := compareVersions(candidate, specified)
+	switch s.Operator {
+	case "==":
+		return comparison == 0
+	case "!=":
+		return comparison != 0
+	case "<":
+		// <2 excludes 2.0rc1 although it is older
+		return comparison < 0 && !(candidate.isPrerelease() && !specified.isPrerelease() && sameRelease(candidate, specified))
+	case "<=":
+		return comparison <= 0
+	case ">":
+		// >2 excludes 2.0.post1 although it is newer
+		return comparison > 0 && !(candidate.isPostrelease() && !specified.isPostrelease() && sameRelease(candidate, specified))
+	case ">=":
+		return comparison >= 0
+	case "~=":
+		// ~=1.4.2 is >=1.4.2,==1.4.*
+		return comparison >= 0 && hasPrefix(candidate.release, specified.release[:len(specified.release)-1])
+	}
+
+	return false
+}
+
+type version struct {
+	epoch   int
+	release []int
+	// pre is the label of a pre-release, a, b or rc, with its number, post and dev are -1 if missing
+	pre        string
+	pre_number int
+	post       int
+	dev        int
+}
+
+// suffix_pattern matches what follows the release segments, separators and numbers are optional
+var suffix_pattern = regexp.MustCompile(
+	`^(?:[-_.]?(a|b|c|rc|alpha|beta|pre|preview)[-_.]?([0-9]*))?` +
+		`(?:-([0-9]+)|[-_.]?(post|rev|r)[-_.]?([0-9]*))?` +
+		`(?:[-_.]?(dev)[-_.]?([0-9]*))?$`,
+)
+
+// pre_labels normalizes the spellings of pre-release labels, they sort as a, b and then rc
+var pre_labels = map[string]string{
+	"a": "a", "alpha": "a",
+	"b": "b", "beta": "b",
+	"c": "rc", "rc": "rc", "pre": "rc", "preview": "rc",
+}
+
+var pre_label_order = map[string]int{"a": 0, "b": 1, "rc": 2}
+
+// parseVersion splits a version into its numbers, local versions after + are ignored
+func parseVersion(value string) (version, bool) {
+	v := version{post: -1, dev: -1}
+
+	value = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "v"))
+	value, _, _ = strings.Cut(value, "+")
+
+	if epoch, rest, ok := strings.Cut(value, "!"); ok {
+		number, err := strconv.Atoi(epoch)
+		if err != nil {
+			return v, false
+		}
+		v.epoch = number
+		value = rest
+	}
+
+	end := 0
+	for end < len(value) && (value[end] == '.' || (value[end] >= '0' && value[end] <= '9')) {
+		end++
+	}
+	// the separator of 1.0.post1 is part of the release until it is trimmed
+	release, suffix := value[:end], value[end:]
+	if trimmed, ok := strings.CutSuffix(release, "."); ok {
+		release, suffix = trimmed, "."+suffix
+	}
+
+	if release == "" {
+		return v, false
+	}
+	for _, segment := range strings.Split(release, ".") {
+		number, err := strconv.Atoi(segment)
+		if err != nil {
+			return v, false
+		}
+		v.release = append(v.release, number)
+	}
+
+	match := suffix_pattern.FindStringSubmatch(suffix)
+	if match == nil {
+		return v, false
+	}
+
+	var ok bool
+	if match[1] != "" {
+		v.pre = pre_labels[match[1]]
+		if v.pre_number, ok = suffixNumber(match[2]); !ok {
+			return v, false
+		}
+	}
+	if match[3] != "" {
+		// 1.0-1 is the implicit post-release
+		if v.post, ok = suffixNumber(match[3]); !ok {
+			return v, false
+		}
+	} else if match[4] != "" {
+		if v.post, ok = suffixNumber(match[5]); !ok {
+			return v, false
+		}
+	}
+	if match[6] != "" {
+		if v.dev, ok = suffixNumber(match[7]); !ok {
+			return v, false
+		}
+	}
+
+	return v, true
+}
+
+// suffixNumber parses the number of a suffix, a missing one is 0
+func suffixNumber(value string) (int, bool) {
+	if value == "" {
+		return 0, true
+	}
+
+	number, err := strconv.Atoi(value)
+	return number, err == nil
+}
+
+func mustParseVersion(value string) version {
+	v, _ := parseVersion(value)
+	return v
+}
+
+func (v version) isPrerelease() bool {
+	return v.pre != "" || v.dev >= 0
+}
+
+func (v version) isPostrelease() bool {
+	return v.post >= 0
+}
+
+// preKey orders the pre-release part, a dev-release of the final release comes before its
+// pre-releases and the final release after them
+func (v version) preKey() (int, int) {
+	switch {
+	case v.pre != "":
+		return pre_label_order[v.pre], v.pre_number
+	case v.post < 0 && v.dev >= 0:
+		return -1, 0
+	default:
+		return len(pre_label_order), 0
+	}
+}
+
+// devKey orders the dev-release part, a release without one comes after its dev-releases
+func (v version) devKey() int {
+	if v.dev < 0 {
+		return int(^uint(0) >> 1)
+	}
+	return v.dev
+}
+
+func compareVersions(a version, b version) int {
+	if a.epoch != b.epoch {
+		return compareInts(a.epoch, b.epoch)
+	}
+
+	for i := 0; i < len(a.release) || i < len(b.release); i++ {
+		if comparison := compareInts(segment(a.release, i), segment(b.release, i)); comparison != 0 {
+			return comparison
+		}
+	}
+
+	a_label, a_number := a.preKey()
+	b_label, b_number := b.preKey()
+	if comparison := compareInts(a_label, b_label); comparison != 0 {
+		return comparison
+	}
+	if comparison := compareInts(a_number, b_number); comparison != 0 {
+		return comparison
+	}
+
+	// a missing post-release is -1 and sorts first
+	if comparison := compareInts(a.post, b.post); comparison != 0 {
+		return comparison
+	}
+
+	return compareInts(a.devKey(), b.devKey())
+}
+
+func sameRelease(a version, b version) bool {
+	return a.epoch == b.epoch && hasPrefix(a.release, b.release) && hasPrefix(b.release, a.release)
+}
+
+// hasPrefix reports whether release starts with prefix, missing segments count as 0
+func hasPrefix(release []int, prefix []int) bool {
+	for i := range prefix {
+		if segment(release, i) != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func segment(release []int, i int) int {
+	if i < len(release) {
+		return release[i]
+	}
+	return 0
+}
+
+func compareInts(a int, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
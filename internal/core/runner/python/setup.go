@@ -2,17 +2,20 @@ package python
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path"
-	"regexp"
 	"strings"
 
 	"github.com/langgenius/dify-sandbox/internal/static"
 
 	"github.com/langgenius/dify-sandbox/internal/core/runner"
 	python_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/python/dependencies"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python/requirements"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/utils/log"
 )
@@ -21,103 +24,77 @@ import (
 var python_lib []byte
 
 const (
+	// LIB_PATH holds the versions of the python chroot of the default dependency profile, see Env
 	LIB_PATH = "/var/sandbox/sandbox-python"
 	LIB_NAME = "python.so"
 )
 
-func init() {
-	releaseLibBinary(true)
-}
-
-func releaseLibBinary(force_remove_old_lib bool) {
-	log.Info("initializing python runner environment...")
-	// remove the old lib
-	if _, err := os.Stat(path.Join(LIB_PATH, LIB_NAME)); err == nil {
-		if force_remove_old_lib {
-			err := os.Remove(path.Join(LIB_PATH, LIB_NAME))
-			if err != nil {
-				log.Panic(fmt.Sprintf("failed to remove %s", path.Join(LIB_PATH, LIB_NAME)))
-			}
-
-			// write the new lib
-			err = os.MkdirAll(LIB_PATH, 0755)
-			if err != nil {
-				log.Panic(fmt.Sprintf("failed to create %s", LIB_PATH))
-			}
-			err = os.WriteFile(path.Join(LIB_PATH, LIB_NAME), python_lib, 0755)
-			if err != nil {
-				log.Panic(fmt.Sprintf("failed to write %s", path.Join(LIB_PATH, LIB_NAME)))
-			}
-		}
-	} else {
-		err = os.MkdirAll(LIB_PATH, 0755)
-		if err != nil {
-			log.Panic(fmt.Sprintf("failed to create %s", LIB_PATH))
-		}
-		err = os.WriteFile(path.Join(LIB_PATH, LIB_NAME), python_lib, 0755)
-		if err != nil {
-			log.Panic(fmt.Sprintf("failed to write %s", path.Join(LIB_PATH, LIB_NAME)))
-		}
-		log.Info("python runner environment initialized")
+// releaseLibBinary writes python.so into an environment
+func releaseLibBinary(env_path string) error {
+	lib_path := path.Join(env_path, LIB_NAME)
+	err := os.Remove(lib_path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
 	}
+
+	return os.WriteFile(lib_path, python_lib, 0755)
 }
 
-func checkLibAvaliable() bool {
-	if _, err := os.Stat(path.Join(LIB_PATH, LIB_NAME)); err != nil {
+func checkLibAvaliable(env_path string) bool {
+	if _, err := os.Stat(path.Join(env_path, LIB_NAME)); err != nil {
 		return false
 	}
 
 	return true
 }
 
-func ExtractOnelineDepency(dependency string) (string, string) {
-	delimiters := []string{"==", ">=", "<=", "~="}
-	for _, delimiter := range delimiters {
-		if strings.Contains(dependency, delimiter) {
-			parts := strings.Split(dependency, delimiter)
-			if len(parts) >= 2 {
-				return parts[0], parts[1]
-			} else if len(parts) == 1 {
-				return parts[0], ""
-			} else if len(parts) == 0 {
-				return "", ""
-			}
-		}
+// InstallDependencies installs requirements for a dependency profile, the default profile installs
+// into the site-packages of the interpreter, any other into its own packages directory
+func InstallDependencies(profile string, requirements string) error {
+	if requirements == "" {
+		return nil
+	}
+
+	env, err := GetEnv(profile)
+	if err != nil {
+		return err
 	}
 
-	preg := regexp.MustCompile(`([a-zA-Z0-9_-]+)`)
-	if preg.MatchString(dependency) {
-		return dependency, ""
+	file, err := parseRequirements(env.Profile, requirements)
+	if err != nil {
+		return err
 	}
 
-	return "", ""
+	return installDependencies(env, file, io.Discard)
 }
 
-func InstallDependencies(requirements string) error {
-	if requirements == "" {
+// installDependencies installs the requirements of file into an environment, output receives
+// the output of pip besides the log
+func installDependencies(env *Env, file *requirements.File, output io.Writer) error {
+	if len(file.Requirements) == 0 {
 		return nil
 	}
 
 	runner := runner.TempDirRunner{}
 	return runner.WithTempDir("/", []string{}, func(root_path string) error {
 		defer os.RemoveAll(root_path)
-		// create a requirements file
-		err := os.WriteFile(path.Join(root_path, "requirements.txt"), []byte(requirements), 0644)
+		err := writeRequirements(root_path, file)
 		if err != nil {
 			log.Error("failed to create requirements.txt")
-			return nil
+			return err
 		}
 
 		// install dependencies
-		pipMirrorURL := static.GetDifySandboxGlobalConfigurations().PythonPipMirrorURL
-
-		// Create the base command
 		args := []string{"install", "-r", "requirements.txt"}
-		if pipMirrorURL != "" {
-			// If a mirror URL is provided, include it in the command arguments
-			args = append(args, "-i", pipMirrorURL)
+		if env.PackagesPath() != "" {
+			// --upgrade replaces packages installed by an earlier run instead of failing on them
+			args = append(args, "--target", env.PackagesPath(), "--upgrade")
 		}
+		args = append(args, pipIndexArgs()...)
+
 		cmd := exec.Command("pip3", args...)
+		cmd.Dir = root_path
+		cmd.Stderr = output
 		reader, err := cmd.StdoutPipe()
 		if err != nil {
 			log.Error("failed to get stdout pipe of pip3")
@@ -138,6 +115,7 @@ func InstallDependencies(requirements string) error {
 				break
 			}
 			log.Info(string(buf[:n]))
+			output.Write(buf[:n])
 		}
 
 		err = cmd.Wait()
@@ -147,36 +125,236 @@ func InstallDependencies(requirements string) error {
 			return err
 		}
 
-		// split the requirements
-		requirements = strings.ReplaceAll(requirements, "\r\n", "\n")
-		requirements = strings.ReplaceAll(requirements, "\r", "\n")
-		lines := strings.Split(requirements, "\n")
-		for _, line := range lines {
-			packageName, version := ExtractOnelineDepency(line)
-			if packageName == "" {
-				continue
-			}
+		log.Info("Python dependencies installed for profile %s", env.Profile)
+		return nil
+	})
+}
+
+// pipIndexArgs returns where pip looks for packages, an offline wheelhouse replaces the index
+func pipIndexArgs() []string {
+	configuration := static.GetDifySandboxGlobalConfigurations()
 
-			python_dependencies.SetupDependency(packageName, version)
-			log.Info("Python dependency installed: %s %s", packageName, version)
+	args := []string{}
+	if configuration.PythonWheelhouse != "" {
+		args = append(args, "--no-index", "--find-links", configuration.PythonWheelhouse)
+	} else if configuration.PythonPipMirrorURL != "" {
+		// If a mirror URL is provided, include it in the command arguments
+		args = append(args, "-i", configuration.PythonPipMirrorURL)
+	}
+
+	if configuration.PythonRequireHashes {
+		args = append(args, "--require-hashes")
+	}
+
+	return args
+}
+
+// parseRequirements parses the requirements of a profile, files they include are read relative
+// to its requirements file
+func parseRequirements(profile string, content string) (*requirements.File, error) {
+	name := static.PythonRequirementsPath(profile)
+	if name == "" {
+		name = "requirements.txt"
+	}
+
+	return requirements.ParseFile(name, content, func(name string) (string, error) {
+		content, err := os.ReadFile(name)
+		return string(content), err
+	})
+}
+
+// writeRequirements writes requirements.txt into dir with the includes of file resolved, pip
+// reads it from there and would look for them in dir otherwise
+func writeRequirements(dir string, file *requirements.File) error {
+	lines := append([]string{}, file.Options...)
+	if len(file.Constraints) > 0 {
+		err := os.WriteFile(path.Join(dir, "constraints.txt"), []byte(formatRequirements(file.Constraints)), 0644)
+		if err != nil {
+			return err
 		}
+		lines = append(lines, "-c constraints.txt")
+	}
+
+	content := strings.Join(lines, "\n") + "\n" + formatRequirements(file.Requirements)
+	return os.WriteFile(path.Join(dir, "requirements.txt"), []byte(content), 0644)
+}
 
+func formatRequirements(list []*requirements.Requirement) string {
+	var builder strings.Builder
+	for _, requirement := range list {
+		builder.WriteString(requirement.Line() + "\n")
+	}
+
+	return builder.String()
+}
+
+// DownloadDependencies downloads the wheels of requirements and their dependencies into a
+// wheelhouse, platform and python_version select wheels for another machine if set
+func DownloadDependencies(profile string, requirements string, wheelhouse string, platform string, python_version string) error {
+	if requirements == "" {
 		return nil
+	}
+
+	file, err := parseRequirements(profile, requirements)
+	if err != nil {
+		return err
+	}
+
+	runner := runner.TempDirRunner{}
+	return runner.WithTempDir("/", []string{}, func(root_path string) error {
+		defer os.RemoveAll(root_path)
+		err := writeRequirements(root_path, file)
+		if err != nil {
+			return err
+		}
+
+		args := []string{"download", "-r", "requirements.txt", "--dest", wheelhouse}
+		if platform != "" || python_version != "" {
+			// pip can only pick wheels for another interpreter, it can not build them
+			args = append(args, "--only-binary=:all:")
+			if platform != "" {
+				args = append(args, "--platform", platform)
+			}
+			if python_version != "" {
+				args = append(args, "--python-version", python_version)
+			}
+		}
+
+		configuration := static.GetDifySandboxGlobalConfigurations()
+		if configuration.PythonPipMirrorURL != "" {
+			args = append(args, "-i", configuration.PythonPipMirrorURL)
+		}
+		if configuration.PythonRequireHashes {
+			args = append(args, "--require-hashes")
+		}
+
+		cmd := exec.Command("pip3", args...)
+		cmd.Dir = root_path
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
 	})
 }
 
-func ListDependencies() []types.Dependency {
-	return python_dependencies.ListDependencies()
+// ListDependencies returns the packages installed in the active version of the environment of a
+// profile, read from their dist-info metadata, with the requirements which pulled them in
+func ListDependencies(profile string) ([]types.Dependency, error) {
+	env, err := GetEnv(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// the version must not be removed while it is read
+	env_path, release, err := env.Versions.Acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	distributions, err := python_dependencies.ReadInstalled(env_path, env.PackagesPath())
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := parseRequirements(env.Profile, static.GetRunnerDependencies().PythonRequirements[env.Profile])
+	if err != nil {
+		return nil, err
+	}
+
+	requested := python_dependencies.Requirements(env.Profile, file.Requirements)
+	return python_dependencies.Resolve(distributions, requested), nil
+}
+
+// RefreshDependencies installs the requirements of a profile again and builds a new version of
+// its environment, output receives the output of pip
+func RefreshDependencies(profile string, output io.Writer) error {
+	env, err := GetEnv(profile)
+	if err != nil {
+		return err
+	}
+
+	log.Info("updating python dependencies of profile %s...", env.Profile)
+	err = refreshDependencies(env, output)
+	if err != nil {
+		return err
+	}
+	log.Info("python dependencies updated")
+
+	return nil
 }
 
-func RefreshDependencies() []types.Dependency {
+// UpdateDependencies installs the requirements of every dependency profile again and builds new
+// versions of their environments, output receives the output of pip
+func UpdateDependencies(output io.Writer) error {
 	log.Info("updating python dependencies...")
-	dependencies := static.GetRunnerDependencies()
-	err := InstallDependencies(dependencies.PythonRequirements)
+	errs := []error{}
+	for _, env := range Envs() {
+		err := refreshDependencies(env, output)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("python dependency profile %s: %w", env.Profile, err))
+		}
+	}
+
+	err := errors.Join(errs...)
 	if err != nil {
-		log.Error("failed to install python dependencies: %v", err)
-		return nil
+		return err
 	}
 	log.Info("python dependencies updated")
-	return python_dependencies.ListDependencies()
+
+	return nil
+}
+
+// UpdateChangedDependencies updates the dependency profiles whose requirements or installed
+// packages changed since their environments were built and returns how many it updated
+func UpdateChangedDependencies(output io.Writer) (int, error) {
+	updated := 0
+	errs := []error{}
+	for _, env := range Envs() {
+		if !env.Changed() {
+			fmt.Fprintf(output, "python dependency profile %s is unchanged, skipped\n", env.Profile)
+			continue
+		}
+
+		updated++
+		err := refreshDependencies(env, output)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("python dependency profile %s: %w", env.Profile, err))
+		}
+	}
+
+	return updated, errors.Join(errs...)
+}
+
+func refreshDependencies(env *Env, output io.Writer) error {
+	file, err := parseRequirements(env.Profile, static.GetRunnerDependencies().PythonRequirements[env.Profile])
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(output, "installing the requirements of python dependency profile %s\n", env.Profile)
+	err = installDependencies(env, file, output)
+	if err != nil {
+		log.Error("failed to install python dependencies: %v", err)
+		return err
+	}
+
+	err = prepareEnv(env, output)
+	if err != nil {
+		log.Error("failed to prepare python dependencies environment: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// prepareEnv builds a new version of an environment and reports it to output
+func prepareEnv(env *Env, output io.Writer) error {
+	err := env.Prepare()
+	if err != nil {
+		return err
+	}
+
+	active, _ := env.Versions.Active()
+	fmt.Fprintf(output, "python chroot environment %s v%d is active\n", env.Profile, active)
+	return nil
 }
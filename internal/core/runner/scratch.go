@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+)
+
+// SCRATCH_DIR holds the scratch directories of running executions
+const SCRATCH_DIR = "/var/sandbox/scratch"
+
+// Scratch is the private writable directory of an execution, a tmpfs capped at scratch_size
+// which the sandboxed process mounts as its working directory and /tmp
+//
+// the server can not mount in rootless mode, the sandboxed process mounts the tmpfs in its
+// own mount namespace instead, which is gone with the process, but quota breaches can not be told
+type Scratch struct {
+	path string
+	size int
+}
+
+func NewScratch(uid int, gid int) (*Scratch, error) {
+	size := static.GetDifySandboxGlobalConfigurations().ScratchSize << 20
+	if static.SANDBOX_ROOTLESS {
+		return &Scratch{size: size}, nil
+	}
+
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	scratch_path := path.Join(SCRATCH_DIR, uuid.String())
+	err = os.MkdirAll(scratch_path, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Mount(
+		"tmpfs", scratch_path, "tmpfs",
+		syscall.MS_NOSUID|syscall.MS_NODEV,
+		fmt.Sprintf("size=%d,mode=0700,uid=%d,gid=%d", size, uid, gid),
+	)
+	if err != nil {
+		os.Remove(scratch_path)
+		return nil, err
+	}
+
+	return &Scratch{path: scratch_path, size: size}, nil
+}
+
+// Env tells the sandboxed process where to find the scratch directory, or how large to make it
+func (s *Scratch) Env() string {
+	if s.path == "" {
+		return fmt.Sprintf("%s=%d", lib.ENV_SCRATCH_SIZE, s.size)
+	}
+	return fmt.Sprintf("%s=%s", lib.ENV_SCRATCH_PATH, s.path)
+}
+
+// QuotaExceeded reports whether the execution ran out of space or inodes in the scratch directory
+func (s *Scratch) QuotaExceeded() bool {
+	if s.path == "" {
+		return false
+	}
+
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(s.path, &stat)
+	if err != nil {
+		return false
+	}
+
+	return stat.Bavail == 0 || stat.Ffree == 0
+}
+
+// QuotaError is written to stderr of an execution which exceeded the quota
+func (s *Scratch) QuotaError() string {
+	return fmt.Sprintf("error: scratch directory quota of %dMB exceeded\n", s.size>>20)
+}
+
+// Remove wipes the scratch directory, nothing written by the execution survives it
+func (s *Scratch) Remove() {
+	if s.path == "" {
+		return
+	}
+
+	err := syscall.Unmount(s.path, syscall.MNT_DETACH)
+	if err != nil {
+		log.Warn("failed to unmount scratch directory %s: %v", s.path, err)
+	}
+
+	err = os.RemoveAll(s.path)
+	if err != nil {
+		log.Warn("failed to remove scratch directory %s: %v", s.path, err)
+	}
+}
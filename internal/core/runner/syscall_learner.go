@@ -0,0 +1,163 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	sg "github.com/seccomp/libseccomp-golang"
+	"golang.org/x/sys/unix"
+)
+
+// SECCOMP_LISTENER_LINK is what /proc/<pid>/fd shows for the listener of a learning filter
+const SECCOMP_LISTENER_LINK = "anon_inode:seccomp notify"
+
+// SyscallLearner supervises a process started with ENV_SECCOMP_LEARN and records every
+// syscall it makes, the syscalls are let through unchanged
+type SyscallLearner struct {
+	lock     sync.Mutex
+	syscalls map[int]bool
+	err      error
+	done     chan bool
+}
+
+func NewSyscallLearner() *SyscallLearner {
+	return &SyscallLearner{
+		syscalls: map[int]bool{},
+		done:     make(chan bool),
+	}
+}
+
+// Attach starts supervising the process, a process which can not be supervised is killed
+// as it would block on its first syscall forever
+func (l *SyscallLearner) Attach(pid int) {
+	go func() {
+		defer close(l.done)
+
+		err := l.supervise(pid)
+		if err != nil {
+			l.lock.Lock()
+			l.err = err
+			l.lock.Unlock()
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}()
+}
+
+// Wait blocks until the supervised process has exited
+func (l *SyscallLearner) Wait() error {
+	<-l.done
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.err
+}
+
+// Syscalls returns the sorted names of the recorded syscalls
+func (l *SyscallLearner) Syscalls() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	names := []string{}
+	for nr := range l.syscalls {
+		names = append(names, lib.SyscallName(nr))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (l *SyscallLearner) supervise(pid int) error {
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open pidfd: %v", err)
+	}
+	defer unix.Close(pidfd)
+
+	listener, err := l.takeListener(pid, pidfd)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(listener)
+
+	fds := []unix.PollFd{{Fd: int32(listener), Events: unix.POLLIN}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return err
+		}
+
+		if fds[0].Revents&unix.POLLIN != 0 {
+			l.receive(sg.ScmpFd(listener))
+			continue
+		}
+
+		// every thread using the filter has exited
+		if fds[0].Revents&unix.POLLHUP != 0 {
+			return nil
+		}
+	}
+}
+
+// receive records a pending syscall and lets it continue
+func (l *SyscallLearner) receive(listener sg.ScmpFd) {
+	req, err := sg.NotifReceive(listener)
+	if err != nil {
+		// the thread was killed while waiting for the response
+		return
+	}
+
+	l.lock.Lock()
+	l.syscalls[int(req.Data.Syscall)] = true
+	l.lock.Unlock()
+
+	sg.NotifRespond(listener, &sg.ScmpNotifResp{
+		ID:    req.ID,
+		Flags: sg.NotifRespFlagContinue,
+	})
+}
+
+// takeListener copies the listener out of the process once it has loaded the learning filter
+func (l *SyscallLearner) takeListener(pid int, pidfd int) (int, error) {
+	fds := []unix.PollFd{{Fd: int32(pidfd), Events: unix.POLLIN}}
+	fd_dir := fmt.Sprintf("/proc/%d/fd", pid)
+
+	for {
+		entries, _ := os.ReadDir(fd_dir)
+		for _, entry := range entries {
+			link, err := os.Readlink(filepath.Join(fd_dir, entry.Name()))
+			if err != nil || link != SECCOMP_LISTENER_LINK {
+				continue
+			}
+
+			target_fd, err := strconv.Atoi(entry.Name())
+			if err != nil {
+				continue
+			}
+
+			listener, err := unix.PidfdGetfd(pidfd, target_fd, 0)
+			if err != nil {
+				return -1, fmt.Errorf("failed to take seccomp listener: %v", err)
+			}
+			return listener, nil
+		}
+
+		// the pidfd becomes readable once the process has exited
+		n, err := unix.Poll(fds, 10)
+		if err != nil && !errors.Is(err, syscall.EINTR) {
+			return -1, err
+		}
+		if n > 0 {
+			return -1, errors.New("process exited before loading the learning filter")
+		}
+	}
+}
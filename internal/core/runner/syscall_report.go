@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+	"github.com/langgenius/dify-sandbox/internal/utils/metrics"
+	sg "github.com/seccomp/libseccomp-golang"
+	"golang.org/x/sys/unix"
+)
+
+// SyscallReport supervises the seccomp listener of a sandboxed process, the process tells which fd
+// the listener is over a socket and waits until we have taken a copy, a blocked syscall is recorded
+// and the process is killed before the syscall returns
+type SyscallReport struct {
+	conn  *os.File
+	child *os.File
+
+	lock    sync.Mutex
+	blocked int
+	killed  bool
+}
+
+func NewSyscallReport() (*SyscallReport, error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyscallReport{
+		conn:  os.NewFile(uintptr(fds[0]), "syscall-report"),
+		child: os.NewFile(uintptr(fds[1]), "syscall-report"),
+	}, nil
+}
+
+// File is inherited by the sandboxed process, it closes it before running untrusted code
+func (r *SyscallReport) File() *os.File {
+	return r.child
+}
+
+// Env tells the sandboxed process which fd the file was inherited as
+func (r *SyscallReport) Env(fd int) string {
+	return fmt.Sprintf("%s=%d", seccomp_profile.ENV_SYSCALL_REPORT_FD, fd)
+}
+
+func (r *SyscallReport) Close() {
+	r.child.Close()
+	r.conn.Close()
+}
+
+// Attach starts supervising the started process, a process whose listener can not be taken is
+// killed as it would block on its first blocked syscall until the timeout
+func (r *SyscallReport) Attach(pid int) {
+	// the process holds its own copy
+	r.child.Close()
+
+	go func() {
+		err := r.supervise(pid)
+		if err != nil {
+			log.Warn("failed to supervise blocked syscalls of %d: %v", pid, err)
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}()
+}
+
+func (r *SyscallReport) supervise(pid int) error {
+	listener, err := r.takeListener(pid)
+	if err != nil || listener < 0 {
+		return err
+	}
+	defer unix.Close(listener)
+
+	fds := []unix.PollFd{{Fd: int32(listener), Events: unix.POLLIN}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return err
+		}
+
+		if fds[0].Revents&unix.POLLIN != 0 {
+			r.receive(pid, sg.ScmpFd(listener))
+			continue
+		}
+
+		// every thread using the filter has exited
+		if fds[0].Revents&unix.POLLHUP != 0 {
+			return nil
+		}
+	}
+}
+
+// receive records a blocked syscall and kills the process, the notification is never answered
+// so the syscall does not return before the process is gone
+func (r *SyscallReport) receive(pid int, listener sg.ScmpFd) {
+	req, err := sg.NotifReceive(listener)
+	if err != nil {
+		// the thread was killed while waiting for the response
+		return
+	}
+
+	r.lock.Lock()
+	if !r.killed {
+		r.blocked = int(req.Data.Syscall)
+		r.killed = true
+	}
+	r.lock.Unlock()
+
+	// a forked child of the process reports to the same listener
+	syscall.Kill(int(req.Pid), syscall.SIGKILL)
+	syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// takeListener copies the listener the process names out of it and lets it continue, -1 is returned
+// if the process closed the socket without loading a filter which reports
+func (r *SyscallReport) takeListener(pid int) (int, error) {
+	line, err := bufio.NewReader(r.conn).ReadString('\n')
+	if err != nil {
+		return -1, nil
+	}
+
+	target_fd, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return -1, fmt.Errorf("invalid seccomp listener %q", line)
+	}
+
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open pidfd: %v", err)
+	}
+	defer unix.Close(pidfd)
+
+	listener, err := unix.PidfdGetfd(pidfd, target_fd, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to take seccomp listener: %v", err)
+	}
+
+	_, err = r.conn.Write([]byte{1})
+	if err != nil {
+		unix.Close(listener)
+		return -1, err
+	}
+
+	return listener, nil
+}
+
+// blockedSyscall returns the syscall which got the process killed
+func (r *SyscallReport) blockedSyscall() (int, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.blocked, r.killed
+}
+
+// blockedSyscallError builds the error of a process killed for a blocked syscall, naming the syscall if it was reported
+func blockedSyscallError(report *SyscallReport, state *os.ProcessState) (string, bool) {
+	if report != nil {
+		if nr, ok := report.blockedSyscall(); ok {
+			name := lib.SyscallName(nr)
+			log.Warn("sandboxed process was killed by blocked syscall %s (%d)", name, nr)
+			metrics.BLOCKED_SYSCALLS.Inc(name)
+
+			return fmt.Sprintf("error: operation not permitted, syscall %s (%d) is blocked by the sandbox\n", name, nr), true
+		}
+	}
+
+	// killed by the filter itself, a profile which traps or a process started without a report
+	if strings.Contains(state.String(), "bad system call") {
+		return "error: operation not permitted\n", true
+	}
+
+	return "", false
+}
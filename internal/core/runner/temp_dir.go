@@ -10,7 +10,9 @@ import (
 
 type TempDirRunner struct{}
 
-func (s *TempDirRunner) WithTempDir(basedir string, paths []string, closures func(path string) error) error {
+// WithTempDir creates a temporary directory holding copies of paths and passes it to closures,
+// it is removed if it could not be prepared or closures fails, otherwise closures owns it
+func (s *TempDirRunner) WithTempDir(basedir string, paths []string, closures func(path string) error) (err error) {
 	uuid, err := uuid.NewRandom()
 	if err != nil {
 		return err
@@ -22,6 +24,11 @@ func (s *TempDirRunner) WithTempDir(basedir string, paths []string, closures fun
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(tmp_dir)
+		}
+	}()
 
 	// copy files to tmp dir
 	for _, file_path := range paths {
@@ -50,12 +57,8 @@ func (s *TempDirRunner) WithTempDir(basedir string, paths []string, closures fun
 		}
 	}
 
-	// chdir
-	err = os.Chdir(tmp_dir)
-	if err != nil {
-		return err
-	}
-
+	// the working directory is shared by the whole process, commands started in the closure
+	// set tmp_dir as theirs
 	err = closures(tmp_dir)
 	if err != nil {
 		return err
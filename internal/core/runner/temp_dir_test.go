@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWithTempDirRemovedOnError(t *testing.T) {
+	basedir := t.TempDir()
+	err := os.Mkdir(path.Join(basedir, "tmp"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failed")
+	runner := TempDirRunner{}
+
+	created := ""
+	err = runner.WithTempDir(basedir, nil, func(root_path string) error {
+		created = root_path
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := os.Stat(created); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("%s was left behind: %v", created, err)
+	}
+
+	// a closure which succeeded owns the directory
+	err = runner.WithTempDir(basedir, nil, func(root_path string) error {
+		created = root_path
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(created); err != nil {
+		t.Fatalf("%s was removed: %v", created, err)
+	}
+}
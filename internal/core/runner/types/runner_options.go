@@ -5,10 +5,35 @@ import "encoding/json"
 type Dependency struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
+	// Requirement is the requirement which requested the package, empty if others pulled it in
+	Requirement string `json:"requirement,omitempty"`
+	// RequiredBy lists the requested packages which depend on the package, directly or transitively
+	RequiredBy []string `json:"required_by,omitempty"`
+}
+
+// VersionChange is a package whose installed version changed, Before is empty if it was added
+// and After if it was removed
+type VersionChange struct {
+	// Profile is the python dependency profile of the package, empty for node modules
+	Profile string `json:"profile,omitempty"`
+	Name    string `json:"name"`
+	Before  string `json:"before,omitempty"`
+	After   string `json:"after,omitempty"`
 }
 
 type RunnerOptions struct {
 	EnableNetwork bool `json:"enable_network"`
+	// SecurityProfile is the built-in seccomp tier, strict, standard or permissive
+	SecurityProfile string `json:"security_profile"`
+	// DependencyProfile selects the python dependency profile, empty for the default one
+	DependencyProfile string `json:"dependency_profile"`
+	// Learner replaces the seccomp profile with a filter recording every syscall, it is
+	// attached once the process has started
+	Learner SyscallLearner `json:"-"`
+}
+
+type SyscallLearner interface {
+	Attach(pid int)
 }
 
 func (r *RunnerOptions) Json() string {
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrUidPoolExhausted is returned when no uid became available in time
+var ErrUidPoolExhausted = errors.New("no sandbox uid is available, too many concurrent executions")
+
+// UidPool hands out distinct uids to concurrent executions,
+// the gid of an execution is the same number as its uid
+type UidPool struct {
+	uids chan int
+}
+
+func NewUidPool(start int, size int) *UidPool {
+	if size <= 0 {
+		size = 1
+	}
+
+	pool := &UidPool{
+		uids: make(chan int, size),
+	}
+
+	for i := 0; i < size; i++ {
+		pool.uids <- start + i
+	}
+
+	return pool
+}
+
+// Acquire blocks until a uid is available, or fails once timeout has passed
+func (p *UidPool) Acquire(timeout time.Duration) (int, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case uid := <-p.uids:
+		return uid, nil
+	case <-timer.C:
+		return 0, ErrUidPoolExhausted
+	}
+}
+
+func (p *UidPool) Release(uid int) {
+	p.uids <- uid
+}
+
+var (
+	sandbox_uid_pool      *UidPool
+	sandbox_uid_pool_lock = &sync.Mutex{}
+)
+
+func setupUidPool(start int, size int) {
+	sandbox_uid_pool_lock.Lock()
+	defer sandbox_uid_pool_lock.Unlock()
+	sandbox_uid_pool = NewUidPool(start, size)
+}
+
+func getUidPool() *UidPool {
+	sandbox_uid_pool_lock.Lock()
+	defer sandbox_uid_pool_lock.Unlock()
+	return sandbox_uid_pool
+}
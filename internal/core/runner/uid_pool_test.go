@@ -0,0 +1,52 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUidPoolExhausted(t *testing.T) {
+	pool := NewUidPool(1000, 2)
+
+	acquired := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		uid, err := pool.Acquire(time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acquired[uid] = true
+	}
+	if !acquired[1000] || !acquired[1001] {
+		t.Fatalf("unexpected uids %v", acquired)
+	}
+
+	_, err := pool.Acquire(10 * time.Millisecond)
+	if !errors.Is(err, ErrUidPoolExhausted) {
+		t.Fatalf("expected the pool to be exhausted, got %v", err)
+	}
+
+	// a released uid is handed to a waiting execution
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pool.Release(1001)
+	}()
+
+	uid, err := pool.Acquire(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != 1001 {
+		t.Fatalf("expected the released uid, got %d", uid)
+	}
+}
+
+func TestUidPoolSize(t *testing.T) {
+	// a pool always holds at least one uid
+	pool := NewUidPool(1000, 0)
+
+	uid, err := pool.Acquire(time.Second)
+	if err != nil || uid != 1000 {
+		t.Fatalf("unexpected uid %d, %v", uid, err)
+	}
+}
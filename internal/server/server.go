@@ -2,11 +2,15 @@ package server
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/langgenius/dify-sandbox/internal/controller"
+	"github.com/langgenius/dify-sandbox/internal/core/runner"
+	nodejs_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/nodejs/dependencies"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
+	"github.com/langgenius/dify-sandbox/internal/service"
 	"github.com/langgenius/dify-sandbox/internal/static"
 	"github.com/langgenius/dify-sandbox/internal/utils/log"
 )
@@ -19,6 +23,14 @@ func initConfig() {
 	}
 	log.Info("config init success")
 
+	err = static.SetupSeccompProfiles()
+	if err != nil {
+		log.Panic("failed to load seccomp profiles: %v", err)
+	}
+
+	runner.Setup()
+	log.Info("sandbox runner init success")
+
 	err = static.SetupRunnerDependencies()
 	if err != nil {
 		log.Error("failed to setup runner dependencies: %v", err)
@@ -46,7 +58,7 @@ func initServer() {
 func initDependencies() {
 	log.Info("installing python dependencies...")
 	dependencies := static.GetRunnerDependencies()
-	err := python.InstallDependencies(dependencies.PythonRequirements)
+	err := installPythonDependencies(dependencies)
 	if err != nil {
 		log.Panic("failed to install python dependencies: %v", err)
 	}
@@ -59,34 +71,92 @@ func initDependencies() {
 	}
 	log.Info("python dependencies sandbox initialized")
 
-	// start a ticker to update python dependencies to keep the sandbox up-to-date
-	go func() {
-		updateInterval := static.GetDifySandboxGlobalConfigurations().PythonDepsUpdateInterval
-		tickerDuration, err := time.ParseDuration(updateInterval)
+	if dependencies.NodejsRequirements != "" {
+		log.Info("installing nodejs dependencies...")
+		err = nodejs_dependencies.InstallDependencies(dependencies.NodejsRequirements, os.Stdout)
 		if err != nil {
-			log.Error("failed to parse python dependencies update interval, skip periodic updates: %v", err)
+			log.Panic("failed to install nodejs dependencies: %v", err)
+		}
+	}
+
+	initChrootVerification()
+
+	// update python dependencies periodically to keep the sandbox up-to-date
+	config := static.GetDifySandboxGlobalConfigurations()
+	interval, err := time.ParseDuration(config.PythonDepsUpdateInterval)
+	if err != nil {
+		log.Error("failed to parse python dependencies update interval, skip periodic updates: %v", err)
+		return
+	}
+
+	jitter := interval / 10
+	if config.PythonDepsUpdateJitter != "" {
+		jitter, err = time.ParseDuration(config.PythonDepsUpdateJitter)
+		if err != nil {
+			log.Error("failed to parse python dependencies update jitter, skip periodic updates: %v", err)
 			return
 		}
-		ticker := time.NewTicker(tickerDuration)
+	}
+
+	go service.RunScheduledUpdates(interval, jitter)
+}
+
+func initChrootVerification() {
+	verification := static.GetDifySandboxGlobalConfigurations().ChrootVerification
+	if verification.OnStartup {
+		verifyPythonDependenciesEnv(verification.AutoRebuild)
+	}
+
+	if verification.Interval == "" {
+		return
+	}
+
+	interval, err := time.ParseDuration(verification.Interval)
+	if err != nil {
+		log.Error("failed to parse chroot verification interval, skip periodic checks: %v", err)
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
 		for range ticker.C {
-			if err:=updatePythonDependencies(dependencies);err!=nil{
-				log.Error("Failed to update Python dependencies: %v", err)
-			}
+			verifyPythonDependenciesEnv(verification.AutoRebuild)
 		}
 	}()
 }
 
-func updatePythonDependencies(dependencies static.RunnerDependencies) error {
-	log.Info("Updating Python dependencies...")
-	if err := python.InstallDependencies(dependencies.PythonRequirements); err != nil {
-		log.Error("Failed to install Python dependencies: %v", err)
-		return err
+func verifyPythonDependenciesEnv(rebuild bool) {
+	for _, env := range python.Envs() {
+		result, err := env.Verify(rebuild)
+		if err != nil {
+			log.Error("failed to verify python chroot environment %s: %v", env.Profile, err)
+			continue
+		}
+
+		if result.Intact() {
+			log.Info("python chroot environment %s verified", env.Profile)
+			continue
+		}
+
+		log.Error(
+			"python chroot environment %s does not match its manifest: added %v, modified %v, deleted %v",
+			env.Profile, result.Added, result.Modified, result.Deleted,
+		)
+		if rebuild {
+			log.Info("python chroot environment %s rebuilt", env.Profile)
+		}
 	}
-	if err := python.PreparePythonDependenciesEnv(); err != nil {
-		log.Error("Failed to prepare Python dependencies environment: %v", err)
-		return err
+}
+
+// installPythonDependencies installs the requirements of every dependency profile
+func installPythonDependencies(dependencies static.RunnerDependencies) error {
+	for _, env := range python.Envs() {
+		err := python.InstallDependencies(env.Profile, dependencies.PythonRequirements[env.Profile])
+		if err != nil {
+			return err
+		}
 	}
-	log.Info("Python dependencies updated successfully.")
+
 	return nil
 }
 
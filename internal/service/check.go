@@ -2,13 +2,20 @@ package service
 
 import (
 	"errors"
+	"fmt"
 
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
 )
 
 var (
-	ErrNetworkDisabled = errors.New("network is disabled, please enable it in the configuration")
+	ErrNetworkDisabled               = errors.New("network is disabled, please enable it in the configuration")
+	ErrSecurityProfileNotAllowed     = errors.New("security profile is less restrictive than the server allows")
+	ErrSecurityProfileOverridden     = errors.New("security profile can not be selected, a custom seccomp policy is configured")
+	ErrSecurityProfileNotSupported   = errors.New("security profile is not supported by this language")
+	ErrDependencyProfileNotSupported = errors.New("dependency profile is not supported by this language")
 )
 
 func checkOptions(options *types.RunnerOptions) error {
@@ -20,3 +27,34 @@ func checkOptions(options *types.RunnerOptions) error {
 
 	return nil
 }
+
+// checkPython3SecurityProfile validates the requested tier against the server maximum,
+// the default tier of the server is used if the request does not select one
+func checkPython3SecurityProfile(env *python.Env, options *types.RunnerOptions) error {
+	configuration := static.GetDifySandboxGlobalConfigurations()
+
+	if options.SecurityProfile == "" {
+		options.SecurityProfile = configuration.SecurityProfile.Default
+		return nil
+	}
+
+	if len(configuration.AllowedSyscalls) > 0 || configuration.SeccompProfiles.Python3 != "" || env.SeccompProfile() != "" {
+		return ErrSecurityProfileOverridden
+	}
+
+	level, err := seccomp_profile.SecurityProfileLevel(options.SecurityProfile)
+	if err != nil {
+		return err
+	}
+
+	max_level, err := seccomp_profile.SecurityProfileLevel(configuration.SecurityProfile.Max)
+	if err != nil {
+		return err
+	}
+
+	if level > max_level {
+		return fmt.Errorf("%w: %s, maximum is %s", ErrSecurityProfileNotAllowed, options.SecurityProfile, configuration.SecurityProfile.Max)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
+	"github.com/langgenius/dify-sandbox/internal/types"
+)
+
+type VerifyChrootResponse struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Deleted  []string `json:"deleted"`
+	// Rebuilt is set if the environment had drifted and was rebuilt on request
+	Rebuilt bool `json:"rebuilt"`
+}
+
+func VerifyPython3Chroot(profile string, rebuild bool) *types.DifySandboxResponse {
+	env, err := python.GetEnv(profile)
+	if err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+
+	result, err := env.Verify(rebuild)
+	if err != nil {
+		return types.ErrorResponse(-500, err.Error())
+	}
+
+	return types.SuccessResponse(&VerifyChrootResponse{
+		Added:    result.Added,
+		Modified: result.Modified,
+		Deleted:  result.Deleted,
+		Rebuilt:  rebuild && !result.Intact(),
+	})
+}
+
+type RollbackChrootResponse struct {
+	// Version is the reactivated version of the environment
+	Version int `json:"version"`
+}
+
+func RollbackPython3Chroot(profile string) *types.DifySandboxResponse {
+	env, err := python.GetEnv(profile)
+	if err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+
+	version, err := env.Rollback()
+	if err != nil {
+		return types.ErrorResponse(-500, err.Error())
+	}
+
+	return types.SuccessResponse(&RollbackChrootResponse{
+		Version: version,
+	})
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"github.com/langgenius/dify-sandbox/internal/core/jobs"
+	nodejs_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/nodejs/dependencies"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
+	python_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/python/dependencies"
+	runner_types "github.com/langgenius/dify-sandbox/internal/core/runner/types"
+	"github.com/langgenius/dify-sandbox/internal/types"
+)
+
+const (
+	LANGUAGE_PYTHON3 = "python3"
+	LANGUAGE_NODEJS  = "nodejs"
+
+	JOB_ADD_DEPENDENCY       = "add_dependency"
+	JOB_REMOVE_DEPENDENCY    = "remove_dependency"
+	JOB_REFRESH_DEPENDENCIES = "refresh_dependencies"
+	JOB_UPDATE_DEPENDENCIES  = "update_dependencies"
+	// JOB_SCHEDULED_UPDATE is the periodic update of the dependencies of every profile
+	JOB_SCHEDULED_UPDATE = "scheduled_update"
+)
+
+type DependencyJobResponse struct {
+	Job jobs.Snapshot `json:"job"`
+}
+
+type DependencyJobsResponse struct {
+	Jobs []jobs.Snapshot `json:"jobs"`
+}
+
+func AddPython3Dependency(profile string, requirement string, hashes []string) *types.DifySandboxResponse {
+	change, err := python.NewAddDependency(profile, requirement, hashes)
+	if err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+
+	return submitDependencyJob(JOB_ADD_DEPENDENCY, LANGUAGE_PYTHON3, change.Profile(), func(job *jobs.Job) error {
+		return change.Apply(job)
+	})
+}
+
+func RemovePython3Dependency(profile string, name string) *types.DifySandboxResponse {
+	change, err := python.NewRemoveDependency(profile, name)
+	if err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+
+	return submitDependencyJob(JOB_REMOVE_DEPENDENCY, LANGUAGE_PYTHON3, change.Profile(), func(job *jobs.Job) error {
+		return change.Apply(job)
+	})
+}
+
+func submitDependencyJob(kind string, language string, profile string, run func(job *jobs.Job) error) *types.DifySandboxResponse {
+	job, err := submitTrackedJob(kind, language, profile, run)
+	if err != nil {
+		return types.ErrorResponse(-500, err.Error())
+	}
+
+	return types.SuccessResponse(&DependencyJobResponse{
+		Job: job.Snapshot(false),
+	})
+}
+
+// submitTrackedJob submits a job changing the dependencies of a language, for python of a
+// profile or every profile if it is empty, the packages installed before and after it are
+// compared for the changes of the job
+func submitTrackedJob(kind string, language string, profile string, run func(job *jobs.Job) error) (*jobs.Job, error) {
+	return jobs.Submit(kind, language, profile, func(job *jobs.Job) error {
+		listings := dependencyListings(language, profile)
+
+		before := map[string][]runner_types.Dependency{}
+		for profile, list := range listings {
+			// an environment which was never built has nothing installed
+			before[profile], _ = list()
+		}
+
+		err := run(job)
+
+		for profile, list := range listings {
+			after, list_err := list()
+			if list_err != nil {
+				job.Logf("failed to list the dependencies of %s: %v", language, list_err)
+				continue
+			}
+			job.AddChanges(python_dependencies.Diff(profile, before[profile], after)...)
+		}
+
+		return err
+	})
+}
+
+// dependencyListings returns how to list the dependencies a job may change by profile
+func dependencyListings(language string, profile string) map[string]func() ([]runner_types.Dependency, error) {
+	listings := map[string]func() ([]runner_types.Dependency, error){}
+	if language == LANGUAGE_NODEJS {
+		listings[""] = func() ([]runner_types.Dependency, error) {
+			dependencies, err := nodejs_dependencies.ListDependencies()
+			if err != nil {
+				return nil, err
+			}
+
+			// a module installed in several versions is compared by all of them
+			merged := []runner_types.Dependency{}
+			for _, dependency := range dependencies {
+				last := len(merged) - 1
+				if last >= 0 && merged[last].Name == dependency.Name {
+					merged[last].Version += ", " + dependency.Version
+					continue
+				}
+				merged = append(merged, dependency)
+			}
+			return merged, nil
+		}
+		return listings
+	}
+
+	profiles := []string{profile}
+	if profile == "" {
+		profiles = []string{}
+		for _, env := range python.Envs() {
+			profiles = append(profiles, env.Profile)
+		}
+	}
+
+	for _, profile := range profiles {
+		profile := profile
+		listings[profile] = func() ([]runner_types.Dependency, error) {
+			return python.ListDependencies(profile)
+		}
+	}
+	return listings
+}
+
+func ListDependencyJobs() *types.DifySandboxResponse {
+	return types.SuccessResponse(&DependencyJobsResponse{
+		Jobs: jobs.List(),
+	})
+}
+
+func GetDependencyJob(id string) *types.DifySandboxResponse {
+	job, ok := jobs.Get(id)
+	if !ok {
+		return types.ErrorResponse(-404, "job not found")
+	}
+
+	return types.SuccessResponse(&DependencyJobResponse{
+		Job: job.Snapshot(true),
+	})
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"github.com/langgenius/dify-sandbox/internal/core/runner"
+	runner_types "github.com/langgenius/dify-sandbox/internal/core/runner/types"
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
+	"github.com/langgenius/dify-sandbox/internal/types"
+)
+
+type LearnSeccompProfileResponse struct {
+	Profile *seccomp_profile.SeccompProfile `json:"profile"`
+	Stdout  string                          `json:"stdout"`
+	Stderr  string                          `json:"error"`
+}
+
+// LearnSeccompProfile runs the code with every syscall allowed and builds a profile which
+// allows exactly the syscalls it made, the code is trusted as nothing is blocked
+func LearnSeccompProfile(language string, name string, code string, enable_network bool) *types.DifySandboxResponse {
+	learner := runner.NewSyscallLearner()
+	options := &runner_types.RunnerOptions{
+		EnableNetwork: enable_network,
+		Learner:       learner,
+	}
+
+	var resp *types.DifySandboxResponse
+	switch language {
+	case "python3":
+		resp = RunPython3Code(code, "", options)
+	case "nodejs":
+		resp = RunNodeJsCode(code, "", options)
+	default:
+		return types.ErrorResponse(-400, "unsupported language")
+	}
+
+	if resp.Code != 0 {
+		return resp
+	}
+
+	if err := learner.Wait(); err != nil {
+		return types.ErrorResponse(-500, err.Error())
+	}
+
+	result := resp.Data.(*RunCodeResponse)
+	return types.SuccessResponse(&LearnSeccompProfileResponse{
+		Profile: &seccomp_profile.SeccompProfile{
+			Name:          name,
+			DefaultAction: seccomp_profile.ACTION_KILL_PROCESS,
+			Allow:         learner.Syscalls(),
+		},
+		Stdout: result.Stdout,
+		Stderr: result.Stderr,
+	})
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"github.com/langgenius/dify-sandbox/internal/types"
+	"github.com/langgenius/dify-sandbox/internal/utils/metrics"
+)
+
+type MetricsResponse struct {
+	// BlockedSyscalls counts the executions killed by seccomp per syscall name
+	BlockedSyscalls map[string]int64 `json:"blocked_syscalls"`
+}
+
+func GetMetrics() *types.DifySandboxResponse {
+	return types.SuccessResponse(&MetricsResponse{
+		BlockedSyscalls: metrics.BLOCKED_SYSCALLS.Values(),
+	})
+}
@@ -3,7 +3,9 @@ package service
 import (
 	"time"
 
+	"github.com/langgenius/dify-sandbox/internal/core/jobs"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/nodejs"
+	nodejs_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/nodejs/dependencies"
 	runner_types "github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/static"
 	"github.com/langgenius/dify-sandbox/internal/types"
@@ -14,6 +16,10 @@ func RunNodeJsCode(code string, preload string, options *runner_types.RunnerOpti
 		return types.ErrorResponse(-400, err.Error())
 	}
 
+	if options.SecurityProfile != "" {
+		return types.ErrorResponse(-400, ErrSecurityProfileNotSupported.Error())
+	}
+
 	
 	if !static.GetDifySandboxGlobalConfigurations().EnablePreload {
 	    preload = ""
@@ -50,3 +56,39 @@ func RunNodeJsCode(code string, preload string, options *runner_types.RunnerOpti
 		}
 	}
 }
+
+func ListNodejsDependencies(profile string) *types.DifySandboxResponse {
+	if profile != "" {
+		return types.ErrorResponse(-400, ErrDependencyProfileNotSupported.Error())
+	}
+
+	dependencies, err := nodejs_dependencies.ListDependencies()
+	if err != nil {
+		return types.ErrorResponse(-500, err.Error())
+	}
+
+	return types.SuccessResponse(&ListDependenciesResponse{
+		Dependencies: dependencies,
+	})
+}
+
+func RefreshNodejsDependencies(profile string) *types.DifySandboxResponse {
+	if profile != "" {
+		return types.ErrorResponse(-400, ErrDependencyProfileNotSupported.Error())
+	}
+
+	return submitNodejsInstall(JOB_REFRESH_DEPENDENCIES)
+}
+
+// UpdateNodejsDependencies is the same as RefreshNodejsDependencies, node modules have no
+// profiles to update all at once
+func UpdateNodejsDependencies() *types.DifySandboxResponse {
+	return submitNodejsInstall(JOB_UPDATE_DEPENDENCIES)
+}
+
+// submitNodejsInstall installs the node modules of the requirements again in a job
+func submitNodejsInstall(kind string) *types.DifySandboxResponse {
+	return submitDependencyJob(kind, LANGUAGE_NODEJS, "", func(job *jobs.Job) error {
+		return nodejs_dependencies.InstallDependencies(static.GetRunnerDependencies().NodejsRequirements, job)
+	})
+}
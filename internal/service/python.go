@@ -3,6 +3,7 @@ package service
 import (
 	"time"
 
+	"github.com/langgenius/dify-sandbox/internal/core/jobs"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
 	runner_types "github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/static"
@@ -19,6 +20,15 @@ func RunPython3Code(code string, preload string, options *runner_types.RunnerOpt
 		return types.ErrorResponse(-400, err.Error())
 	}
 
+	env, err := python.GetEnv(options.DependencyProfile)
+	if err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+
+	if err := checkPython3SecurityProfile(env, options); err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+
 	if !static.GetDifySandboxGlobalConfigurations().EnablePreload {
 	    preload = ""
 	}
@@ -61,29 +71,34 @@ type ListDependenciesResponse struct {
 	Dependencies []runner_types.Dependency `json:"dependencies"`
 }
 
-func ListPython3Dependencies() *types.DifySandboxResponse {
-	return types.SuccessResponse(&ListDependenciesResponse{
-		Dependencies: python.ListDependencies(),
-	})
-}
+func ListPython3Dependencies(profile string) *types.DifySandboxResponse {
+	if _, err := python.GetEnv(profile); err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
 
-type RefreshDependenciesResponse struct {
-	Dependencies []runner_types.Dependency `json:"dependencies"`
-}
+	dependencies, err := python.ListDependencies(profile)
+	if err != nil {
+		return types.ErrorResponse(-500, err.Error())
+	}
 
-func RefreshPython3Dependencies() *types.DifySandboxResponse {
-	return types.SuccessResponse(&RefreshDependenciesResponse{
-		Dependencies: python.RefreshDependencies(),
+	return types.SuccessResponse(&ListDependenciesResponse{
+		Dependencies: dependencies,
 	})
 }
 
-type UpdateDependenciesResponse struct{}
-
-func UpdateDependencies() *types.DifySandboxResponse {
-	err := python.PreparePythonDependenciesEnv()
+func RefreshPython3Dependencies(profile string) *types.DifySandboxResponse {
+	env, err := python.GetEnv(profile)
 	if err != nil {
-		return types.ErrorResponse(-500, err.Error())
+		return types.ErrorResponse(-400, err.Error())
 	}
 
-	return types.SuccessResponse(&UpdateDependenciesResponse{})
+	return submitDependencyJob(JOB_REFRESH_DEPENDENCIES, LANGUAGE_PYTHON3, env.Profile, func(job *jobs.Job) error {
+		return python.RefreshDependencies(env.Profile, job)
+	})
+}
+
+func UpdatePython3Dependencies() *types.DifySandboxResponse {
+	return submitDependencyJob(JOB_UPDATE_DEPENDENCIES, LANGUAGE_PYTHON3, "", func(job *jobs.Job) error {
+		return python.UpdateDependencies(job)
+	})
 }
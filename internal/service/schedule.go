@@ -0,0 +1,81 @@
+package service
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-sandbox/internal/core/jobs"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
+	"github.com/langgenius/dify-sandbox/internal/types"
+	"github.com/langgenius/dify-sandbox/internal/utils/log"
+)
+
+type DependencyScheduleResponse struct {
+	Interval string `json:"interval"`
+	Jitter   string `json:"jitter"`
+	// LastRun is when the last scheduled update finished, LastChange when the last one which
+	// found changes and updated a profile did
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	LastChange *time.Time `json:"last_change,omitempty"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+	// LastJob is the id of the job of the last scheduled update
+	LastJob string `json:"last_job,omitempty"`
+}
+
+var (
+	dependency_schedule      = DependencyScheduleResponse{}
+	dependency_schedule_lock sync.Mutex
+)
+
+// RunScheduledUpdates updates the dependencies of the profiles which changed every interval, a
+// random delay of up to jitter keeps sandboxes started together from updating together
+func RunScheduledUpdates(interval time.Duration, jitter time.Duration) {
+	dependency_schedule_lock.Lock()
+	dependency_schedule.Interval = interval.String()
+	dependency_schedule.Jitter = jitter.String()
+	dependency_schedule_lock.Unlock()
+
+	for {
+		delay := interval
+		if jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(jitter)))
+		}
+
+		next_run := time.Now().Add(delay)
+		dependency_schedule_lock.Lock()
+		dependency_schedule.NextRun = &next_run
+		dependency_schedule_lock.Unlock()
+
+		time.Sleep(delay)
+
+		updated := 0
+		job, err := submitTrackedJob(JOB_SCHEDULED_UPDATE, LANGUAGE_PYTHON3, "", func(job *jobs.Job) error {
+			var err error
+			updated, err = python.UpdateChangedDependencies(job)
+			return err
+		})
+		if err != nil {
+			log.Error("failed to schedule the update of python dependencies: %v", err)
+			continue
+		}
+		job.Wait()
+
+		last_run := time.Now()
+		dependency_schedule_lock.Lock()
+		dependency_schedule.LastRun = &last_run
+		dependency_schedule.LastJob = job.ID()
+		if updated > 0 {
+			dependency_schedule.LastChange = &last_run
+		}
+		dependency_schedule_lock.Unlock()
+	}
+}
+
+func GetDependencySchedule() *types.DifySandboxResponse {
+	dependency_schedule_lock.Lock()
+	defer dependency_schedule_lock.Unlock()
+
+	schedule := dependency_schedule
+	return types.SuccessResponse(&schedule)
+}
@@ -1,10 +1,17 @@
 package static
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/langgenius/dify-sandbox/internal/static/seccomp_profile"
 	"github.com/langgenius/dify-sandbox/internal/types"
 	"github.com/langgenius/dify-sandbox/internal/utils/log"
 	"gopkg.in/yaml.v3"
@@ -12,6 +19,22 @@ import (
 
 var difySandboxGlobalConfigurations types.DifySandboxGlobalConfigurations
 
+// DEFAULT_DEPENDENCY_PROFILE is the python dependency profile of requests which do not select one,
+// it is built from python_lib_path and PYTHON_REQUIREMENTS_PATH
+const DEFAULT_DEPENDENCY_PROFILE = "default"
+
+// PYTHON_REQUIREMENTS_PATH holds the requirements of the default python dependency profile
+const PYTHON_REQUIREMENTS_PATH = "dependencies/python-requirements.txt"
+
+// NODEJS_REQUIREMENTS_PATH is the package.json of the node modules available to nodejs code
+const NODEJS_REQUIREMENTS_PATH = "dependencies/nodejs-requirements.json"
+
+// DEPENDENCY_PROFILE_NAME limits profile names to what is safe as a directory name
+var DEPENDENCY_PROFILE_NAME = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// DEFAULT_SCRATCH_SIZE is the size cap in MB of the writable scratch directory of an execution
+const DEFAULT_SCRATCH_SIZE = 64
+
 func InitConfig(path string) error {
 	difySandboxGlobalConfigurations = types.DifySandboxGlobalConfigurations{}
 
@@ -83,6 +106,29 @@ func InitConfig(path string) error {
 		difySandboxGlobalConfigurations.PythonPipMirrorURL = python_pip_mirror_url
 	}
 
+	python_wheelhouse := os.Getenv("PYTHON_WHEELHOUSE")
+	if python_wheelhouse != "" {
+		difySandboxGlobalConfigurations.PythonWheelhouse = python_wheelhouse
+	}
+
+	// pip runs in a temporary directory, a relative wheelhouse would not be found from there
+	if difySandboxGlobalConfigurations.PythonWheelhouse != "" {
+		difySandboxGlobalConfigurations.PythonWheelhouse, err = filepath.Abs(difySandboxGlobalConfigurations.PythonWheelhouse)
+		if err != nil {
+			return err
+		}
+	}
+
+	python_require_hashes := os.Getenv("PYTHON_REQUIRE_HASHES")
+	if python_require_hashes != "" {
+		difySandboxGlobalConfigurations.PythonRequireHashes, _ = strconv.ParseBool(python_require_hashes)
+	}
+
+	python_dependency_allowlist := os.Getenv("PYTHON_DEPENDENCY_ALLOWLIST")
+	if python_dependency_allowlist != "" {
+		difySandboxGlobalConfigurations.PythonDependencyAllowlist = python_dependency_allowlist
+	}
+
 	python_deps_update_interval := os.Getenv("PYTHON_DEPS_UPDATE_INTERVAL")
 	if python_deps_update_interval != "" {
 		difySandboxGlobalConfigurations.PythonDepsUpdateInterval = python_deps_update_interval
@@ -93,6 +139,22 @@ func InitConfig(path string) error {
 		difySandboxGlobalConfigurations.PythonDepsUpdateInterval = "30m"
 	}
 
+	python_deps_update_jitter := os.Getenv("PYTHON_DEPS_UPDATE_JITTER")
+	if python_deps_update_jitter != "" {
+		difySandboxGlobalConfigurations.PythonDepsUpdateJitter = python_deps_update_jitter
+	}
+
+	for name, profile := range difySandboxGlobalConfigurations.PythonDependencyProfiles {
+		if name == DEFAULT_DEPENDENCY_PROFILE || !DEPENDENCY_PROFILE_NAME.MatchString(name) {
+			return fmt.Errorf("invalid python dependency profile name %s", name)
+		}
+
+		if len(profile.LibPaths) == 0 {
+			profile.LibPaths = difySandboxGlobalConfigurations.PythonLibPaths
+			difySandboxGlobalConfigurations.PythonDependencyProfiles[name] = profile
+		}
+	}
+
 	nodejs_path := os.Getenv("NODEJS_PATH")
 	if nodejs_path != "" {
 		difySandboxGlobalConfigurations.NodejsPath = nodejs_path
@@ -102,6 +164,11 @@ func InitConfig(path string) error {
 		difySandboxGlobalConfigurations.NodejsPath = "/usr/local/bin/node"
 	}
 
+	nodejs_npm_cache := os.Getenv("NODEJS_NPM_CACHE")
+	if nodejs_npm_cache != "" {
+		difySandboxGlobalConfigurations.NodejsNpmCache = nodejs_npm_cache
+	}
+
 	enable_network := os.Getenv("ENABLE_NETWORK")
 	if enable_network != "" {
 		difySandboxGlobalConfigurations.EnableNetwork, _ = strconv.ParseBool(enable_network)
@@ -112,6 +179,91 @@ func InitConfig(path string) error {
 		difySandboxGlobalConfigurations.EnablePreload, _ = strconv.ParseBool(enable_preload)
 	}
 
+	seccomp_profile_dir := os.Getenv("SECCOMP_PROFILE_DIR")
+	if seccomp_profile_dir != "" {
+		difySandboxGlobalConfigurations.SeccompProfileDir = seccomp_profile_dir
+	}
+
+	python_seccomp_profile := os.Getenv("PYTHON_SECCOMP_PROFILE")
+	if python_seccomp_profile != "" {
+		difySandboxGlobalConfigurations.SeccompProfiles.Python3 = python_seccomp_profile
+	}
+
+	nodejs_seccomp_profile := os.Getenv("NODEJS_SECCOMP_PROFILE")
+	if nodejs_seccomp_profile != "" {
+		difySandboxGlobalConfigurations.SeccompProfiles.Nodejs = nodejs_seccomp_profile
+	}
+
+	security_profile_default := os.Getenv("SECURITY_PROFILE_DEFAULT")
+	if security_profile_default != "" {
+		difySandboxGlobalConfigurations.SecurityProfile.Default = security_profile_default
+	}
+
+	if difySandboxGlobalConfigurations.SecurityProfile.Default == "" {
+		difySandboxGlobalConfigurations.SecurityProfile.Default = seccomp_profile.SECURITY_PROFILE_STANDARD
+	}
+
+	security_profile_max := os.Getenv("SECURITY_PROFILE_MAX")
+	if security_profile_max != "" {
+		difySandboxGlobalConfigurations.SecurityProfile.Max = security_profile_max
+	}
+
+	if difySandboxGlobalConfigurations.SecurityProfile.Max == "" {
+		difySandboxGlobalConfigurations.SecurityProfile.Max = difySandboxGlobalConfigurations.SecurityProfile.Default
+	}
+
+	rootless := os.Getenv("ROOTLESS")
+	if rootless != "" {
+		difySandboxGlobalConfigurations.Rootless, _ = strconv.ParseBool(rootless)
+	}
+
+	scratch_size := os.Getenv("SCRATCH_SIZE")
+	if scratch_size != "" {
+		difySandboxGlobalConfigurations.ScratchSize, _ = strconv.Atoi(scratch_size)
+	}
+
+	if difySandboxGlobalConfigurations.ScratchSize <= 0 {
+		difySandboxGlobalConfigurations.ScratchSize = DEFAULT_SCRATCH_SIZE
+	}
+
+	chroot_verify_on_startup := os.Getenv("CHROOT_VERIFY_ON_STARTUP")
+	if chroot_verify_on_startup != "" {
+		difySandboxGlobalConfigurations.ChrootVerification.OnStartup, _ = strconv.ParseBool(chroot_verify_on_startup)
+	}
+
+	chroot_verify_interval := os.Getenv("CHROOT_VERIFY_INTERVAL")
+	if chroot_verify_interval != "" {
+		difySandboxGlobalConfigurations.ChrootVerification.Interval = chroot_verify_interval
+	}
+
+	chroot_verify_auto_rebuild := os.Getenv("CHROOT_VERIFY_AUTO_REBUILD")
+	if chroot_verify_auto_rebuild != "" {
+		difySandboxGlobalConfigurations.ChrootVerification.AutoRebuild, _ = strconv.ParseBool(chroot_verify_auto_rebuild)
+	}
+
+	uid_pool_start := os.Getenv("SANDBOX_UID_POOL_START")
+	if uid_pool_start != "" {
+		difySandboxGlobalConfigurations.SandboxUidPool.Start, _ = strconv.Atoi(uid_pool_start)
+	}
+
+	if difySandboxGlobalConfigurations.SandboxUidPool.Start <= 0 {
+		difySandboxGlobalConfigurations.SandboxUidPool.Start = SANDBOX_USER_UID
+	}
+
+	uid_pool_size := os.Getenv("SANDBOX_UID_POOL_SIZE")
+	if uid_pool_size != "" {
+		difySandboxGlobalConfigurations.SandboxUidPool.Size, _ = strconv.Atoi(uid_pool_size)
+	}
+
+	// every concurrent worker needs its own uid
+	if difySandboxGlobalConfigurations.SandboxUidPool.Size <= 0 {
+		difySandboxGlobalConfigurations.SandboxUidPool.Size = difySandboxGlobalConfigurations.MaxWorkers
+	}
+
+	if difySandboxGlobalConfigurations.SandboxUidPool.Size <= 0 {
+		difySandboxGlobalConfigurations.SandboxUidPool.Size = 1
+	}
+
 	allowed_syscalls := os.Getenv("ALLOWED_SYSCALLS")
 	if allowed_syscalls != "" {
 		strs := strings.Split(allowed_syscalls, ",")
@@ -162,26 +314,140 @@ func GetDifySandboxGlobalConfigurations() types.DifySandboxGlobalConfigurations
 	return difySandboxGlobalConfigurations
 }
 
+// SetupSeccompProfiles loads the profiles of seccomp_profile_dir and checks the ones selected per runtime exist
+func SetupSeccompProfiles() error {
+	config := GetDifySandboxGlobalConfigurations()
+	if config.SeccompProfileDir != "" {
+		err := seccomp_profile.LoadDir(config.SeccompProfileDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	default_level, err := seccomp_profile.SecurityProfileLevel(config.SecurityProfile.Default)
+	if err != nil {
+		return err
+	}
+
+	max_level, err := seccomp_profile.SecurityProfileLevel(config.SecurityProfile.Max)
+	if err != nil {
+		return err
+	}
+
+	if default_level > max_level {
+		return fmt.Errorf(
+			"default security profile %s is less restrictive than the maximum %s",
+			config.SecurityProfile.Default, config.SecurityProfile.Max,
+		)
+	}
+
+	names := []string{config.SeccompProfiles.Python3, config.SeccompProfiles.Nodejs}
+	for _, profile := range config.PythonDependencyProfiles {
+		names = append(names, profile.SeccompProfile)
+	}
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, err := seccomp_profile.Get(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type RunnerDependencies struct {
-	PythonRequirements string
+	// PythonRequirements holds the requirements per python dependency profile
+	PythonRequirements map[string]string
+	// NodejsRequirements is the package.json of the node modules, empty if there is none
+	NodejsRequirements string
 }
 
 var runnerDependencies RunnerDependencies
+var runnerDependenciesLock sync.RWMutex
 
 func GetRunnerDependencies() RunnerDependencies {
+	runnerDependenciesLock.RLock()
+	defer runnerDependenciesLock.RUnlock()
 	return runnerDependencies
 }
 
+// PythonRequirementsPath returns the requirements file of a python dependency profile, empty if
+// the profile has none
+func PythonRequirementsPath(profile string) string {
+	if profile == DEFAULT_DEPENDENCY_PROFILE {
+		return PYTHON_REQUIREMENTS_PATH
+	}
+
+	return GetDifySandboxGlobalConfigurations().PythonDependencyProfiles[profile].Requirements
+}
+
 func SetupRunnerDependencies() error {
-	file, err := os.ReadFile("dependencies/python-requirements.txt")
-	if err != nil {
-		if err == os.ErrNotExist {
-			return nil
+	runnerDependenciesLock.Lock()
+	defer runnerDependenciesLock.Unlock()
+
+	runnerDependencies.PythonRequirements = map[string]string{}
+
+	file, err := os.ReadFile(PYTHON_REQUIREMENTS_PATH)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		runnerDependencies.PythonRequirements[DEFAULT_DEPENDENCY_PROFILE] = string(file)
+	}
+
+	file, err = os.ReadFile(NODEJS_REQUIREMENTS_PATH)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	runnerDependencies.NodejsRequirements = string(file)
+
+	for name, profile := range GetDifySandboxGlobalConfigurations().PythonDependencyProfiles {
+		if profile.Requirements == "" {
+			continue
+		}
+
+		file, err := os.ReadFile(profile.Requirements)
+		if err != nil {
+			return fmt.Errorf("failed to read requirements of python dependency profile %s: %w", name, err)
 		}
+		runnerDependencies.PythonRequirements[name] = string(file)
+	}
+
+	return nil
+}
+
+// SetPythonRequirements writes the requirements of a python dependency profile back to its
+// requirements file, readers keep the requirements they got before
+func SetPythonRequirements(profile string, content string) error {
+	runnerDependenciesLock.Lock()
+	defer runnerDependenciesLock.Unlock()
+
+	path := PythonRequirementsPath(profile)
+	if path == "" {
+		return fmt.Errorf("python dependency profile %s has no requirements file", profile)
+	}
+
+	// a crash while writing must not leave half a requirements file behind
+	tmp_path := path + ".tmp"
+	err := os.WriteFile(tmp_path, []byte(content), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp_path, path)
+	if err != nil {
+		os.Remove(tmp_path)
 		return err
 	}
 
-	runnerDependencies.PythonRequirements = string(file)
+	requirements := make(map[string]string, len(runnerDependencies.PythonRequirements)+1)
+	for name, value := range runnerDependencies.PythonRequirements {
+		requirements[name] = value
+	}
+	requirements[profile] = content
+	runnerDependencies.PythonRequirements = requirements
 
 	return nil
 }
@@ -0,0 +1,10 @@
+//go:build linux && amd64
+
+package seccomp_profile
+
+import "embed"
+
+//go:embed builtin/amd64/*.yaml
+var builtin_fs embed.FS
+
+const builtin_dir = "builtin/amd64"
@@ -0,0 +1,10 @@
+//go:build linux && arm64
+
+package seccomp_profile
+
+import "embed"
+
+//go:embed builtin/arm64/*.yaml
+var builtin_fs embed.FS
+
+const builtin_dir = "builtin/arm64"
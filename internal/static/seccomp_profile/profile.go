@@ -0,0 +1,239 @@
+package seccomp_profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	sg "github.com/seccomp/libseccomp-golang"
+	"gopkg.in/yaml.v3"
+)
+
+// SeccompProfile is a seccomp policy expressed by syscall names, the names are resolved
+// with libseccomp for the running architecture when the filter is loaded
+type SeccompProfile struct {
+	Name string `yaml:"name" json:"name"`
+	// DefaultAction is applied to every syscall which is not listed
+	DefaultAction string `yaml:"default_action" json:"default_action"`
+	// Allow lists syscalls which are always allowed
+	Allow []string `yaml:"allow" json:"allow"`
+	// Network lists syscalls which are only allowed when network is enabled
+	Network []string `yaml:"network" json:"network"`
+	// Errno lists syscalls which fail with ErrnoCode instead of killing the process
+	Errno     []string `yaml:"errno" json:"errno"`
+	ErrnoCode int      `yaml:"errno_code" json:"errno_code"`
+	// Kill lists syscalls which kill the process, only useful with a permissive default action
+	Kill []string `yaml:"kill" json:"kill"`
+	// Rules depend on the arguments of a syscall, see SeccompRule
+	Rules []SeccompRule `yaml:"rules" json:"rules"`
+}
+
+const (
+	ACTION_KILL_PROCESS = "kill_process"
+	ACTION_KILL_THREAD  = "kill_thread"
+	ACTION_ERRNO        = "errno"
+	ACTION_TRAP         = "trap"
+	ACTION_LOG          = "log"
+	ACTION_ALLOW        = "allow"
+
+	// ENV_SECCOMP_PROFILE passes the selected profile to the sandboxed process
+	ENV_SECCOMP_PROFILE = "SECCOMP_PROFILE"
+	// ENV_SYSCALL_REPORT_FD is the fd the sandboxed process reports a blocked syscall to
+	ENV_SYSCALL_REPORT_FD = "SYSCALL_REPORT_FD"
+	// ENV_SECCOMP_LEARN replaces the profile with a filter which records every syscall
+	ENV_SECCOMP_LEARN = "SECCOMP_LEARN"
+)
+
+var (
+	ErrProfileNotFound = errors.New("seccomp profile not found")
+)
+
+func (p *SeccompProfile) Validate() error {
+	if p.Name == "" {
+		return errors.New("seccomp profile name is required")
+	}
+
+	switch p.DefaultAction {
+	case "":
+		p.DefaultAction = ACTION_KILL_PROCESS
+	case ACTION_KILL_PROCESS, ACTION_KILL_THREAD, ACTION_ERRNO, ACTION_TRAP, ACTION_LOG, ACTION_ALLOW:
+	default:
+		return fmt.Errorf("seccomp profile %s: unknown default action %s", p.Name, p.DefaultAction)
+	}
+
+	if p.ErrnoCode < 0 || p.ErrnoCode > 0xffff {
+		return fmt.Errorf("seccomp profile %s: invalid errno code %d", p.Name, p.ErrnoCode)
+	}
+
+	unconditional := map[string]bool{}
+	for _, list := range [][]string{p.Allow, p.Network, p.Errno, p.Kill} {
+		for _, name := range list {
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("seccomp profile %s: empty syscall name", p.Name)
+			}
+			if err := validateSyscall(name); err != nil {
+				return fmt.Errorf("seccomp profile %s: %w", p.Name, err)
+			}
+
+			// the action of a syscall listed twice would depend on the order the lists are added in
+			if unconditional[name] {
+				return fmt.Errorf("seccomp profile %s: %s is listed more than once", p.Name, name)
+			}
+			unconditional[name] = true
+		}
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("seccomp profile %s: %w", p.Name, err)
+		}
+		if err := validateSyscall(rule.Syscall); err != nil {
+			return fmt.Errorf("seccomp profile %s: %w", p.Name, err)
+		}
+
+		// libseccomp rejects them, allowing rules of the same syscall would match instead
+		if rule.Action == p.DefaultAction && (rule.Action != ACTION_ERRNO || rule.ErrnoCode == p.ErrnoCode) {
+			return fmt.Errorf("seccomp profile %s: rule of %s has the default action", p.Name, rule.Syscall)
+		}
+
+		if unconditional[rule.Syscall] {
+			return fmt.Errorf("seccomp profile %s: %s has rules and must not be listed unconditionally", p.Name, rule.Syscall)
+		}
+	}
+
+	// a rule without conditions is unconditional as well
+	for _, rule := range p.Rules {
+		if len(rule.Args) != 0 {
+			continue
+		}
+		for _, other := range p.Rules {
+			if other.Syscall == rule.Syscall && len(other.Args) != 0 {
+				return fmt.Errorf("seccomp profile %s: %s has a rule without conditions and must not have other rules", p.Name, rule.Syscall)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSyscall checks that libseccomp knows a syscall on the running architecture, a profile
+// naming one it does not would only fail once it is loaded by a sandboxed process
+func validateSyscall(name string) error {
+	if _, err := sg.GetSyscallFromName(name); err != nil {
+		return fmt.Errorf("unknown syscall %s", name)
+	}
+	return nil
+}
+
+// Env encodes the profile to be passed through ENV_SECCOMP_PROFILE
+func (p *SeccompProfile) Env() string {
+	b, _ := json.Marshal(p)
+	return fmt.Sprintf("%s=%s", ENV_SECCOMP_PROFILE, string(b))
+}
+
+// FromEnv decodes the profile passed to the sandboxed process, it returns nil if there is none
+func FromEnv() (*SeccompProfile, error) {
+	data := os.Getenv(ENV_SECCOMP_PROFILE)
+	if data == "" {
+		return nil, nil
+	}
+
+	profile := &SeccompProfile{}
+	err := json.Unmarshal([]byte(data), profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, profile.Validate()
+}
+
+func ParseProfile(data []byte) (*SeccompProfile, error) {
+	profile := &SeccompProfile{}
+	err := yaml.Unmarshal(data, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = profile.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+var (
+	profiles      = map[string]*SeccompProfile{}
+	profiles_lock = &sync.RWMutex{}
+)
+
+func Register(profile *SeccompProfile) {
+	profiles_lock.Lock()
+	defer profiles_lock.Unlock()
+	profiles[profile.Name] = profile
+}
+
+func Get(name string) (*SeccompProfile, error) {
+	profiles_lock.RLock()
+	defer profiles_lock.RUnlock()
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+
+	return profile, nil
+}
+
+func List() []string {
+	profiles_lock.RLock()
+	defer profiles_lock.RUnlock()
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// LoadDir registers every *.yaml and *.yml profile in dir
+func LoadDir(dir string) error {
+	return loadFS(os.DirFS(dir))
+}
+
+func loadFS(dir fs.FS) error {
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		ext := path.Ext(entry.Name())
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+
+		data, err := fs.ReadFile(dir, entry.Name())
+		if err != nil {
+			return err
+		}
+
+		profile, err := ParseProfile(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		Register(profile)
+	}
+
+	return nil
+}
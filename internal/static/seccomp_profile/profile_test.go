@@ -0,0 +1,144 @@
+package seccomp_profile
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseProfile(t *testing.T) {
+	cases := []struct {
+		name    string
+		profile string
+		err     string
+	}{
+		{
+			name:    "valid",
+			profile: "name: test\ndefault_action: errno\nerrno_code: 1\nallow: [read, write]\nnetwork: [socket]\nkill: [execve]\n",
+		},
+		{
+			name:    "default action defaults to kill_process",
+			profile: "name: test\nallow: [read]\n",
+		},
+		{
+			name:    "missing name",
+			profile: "allow: [read]\n",
+			err:     "name is required",
+		},
+		{
+			name:    "unknown default action",
+			profile: "name: test\ndefault_action: deny\n",
+			err:     "unknown default action deny",
+		},
+		{
+			name:    "invalid errno code",
+			profile: "name: test\nerrno_code: 65536\n",
+			err:     "invalid errno code 65536",
+		},
+		{
+			name:    "unknown syscall",
+			profile: "name: test\nallow: [read, not_a_syscall]\n",
+			err:     "unknown syscall not_a_syscall",
+		},
+		{
+			name:    "empty syscall name",
+			profile: "name: test\nallow: [read, ' ']\n",
+			err:     "empty syscall name",
+		},
+		{
+			name:    "duplicate in a list",
+			profile: "name: test\nallow: [read, write, read]\n",
+			err:     "read is listed more than once",
+		},
+		{
+			name:    "duplicate across lists",
+			profile: "name: test\nallow: [read]\nkill: [read]\n",
+			err:     "read is listed more than once",
+		},
+		{
+			name:    "malformed yaml",
+			profile: "name: test\nallow: [read\n",
+			err:     "yaml",
+		},
+		{
+			name:    "wrong type",
+			profile: "name: test\nallow: read\n",
+			err:     "cannot unmarshal",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			profile, err := ParseProfile([]byte(c.profile))
+			if c.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if profile.DefaultAction == "" {
+					t.Fatal("the default action was not set")
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("expected an error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestProfileEnv(t *testing.T) {
+	profile, err := ParseProfile([]byte("name: test\nallow: [read]\nrules:\n  - syscall: socket\n    action: allow\n    args:\n      - {index: 0, op: eq, value: AF_INET}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, value, _ := strings.Cut(profile.Env(), "=")
+	if name != ENV_SECCOMP_PROFILE {
+		t.Fatalf("unexpected env %s", name)
+	}
+	t.Setenv(ENV_SECCOMP_PROFILE, value)
+
+	decoded, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Name != "test" || decoded.DefaultAction != ACTION_KILL_PROCESS || len(decoded.Rules) != 1 || decoded.Rules[0].Args[0].Value != "AF_INET" {
+		t.Fatalf("unexpected decoded profile %+v", decoded)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeProfile(t, dir, "custom.yaml", "name: test-custom\nallow: [read]\n")
+	writeProfile(t, dir, "ignored.txt", "not a profile")
+
+	err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("test-custom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("test-missing"); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected ErrProfileNotFound, got %v", err)
+	}
+
+	// the file which failed is named
+	writeProfile(t, dir, "broken.yml", "name: test-broken\nallow: [not_a_syscall]\n")
+	err = LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "broken.yml") {
+		t.Fatalf("expected an error naming broken.yml, got %v", err)
+	}
+}
+
+func writeProfile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+
+	err := os.WriteFile(path.Join(dir, name), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,153 @@
+package seccomp_profile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// SeccompRule applies an action to a syscall only if its arguments match, conditions of a rule
+// are combined with AND, several rules of the same syscall are combined with OR
+//
+// a syscall which has rules must not be listed in allow, network, errno or kill, an unconditional
+// rule of libseccomp always wins over the conditional ones
+type SeccompRule struct {
+	Syscall string `yaml:"syscall" json:"syscall"`
+	// Action is one of the actions of default_action, rules which deny are added before the ones
+	// which allow, so denying wins when several rules match
+	Action    string `yaml:"action" json:"action"`
+	ErrnoCode int    `yaml:"errno_code" json:"errno_code"`
+	// Network rules are only added when network is enabled
+	Network bool             `yaml:"network" json:"network"`
+	Args    []SeccompRuleArg `yaml:"args" json:"args"`
+}
+
+// SeccompRuleArg compares an argument of the syscall, values are numbers or the names
+// of ARG_CONSTANTS which can be combined with `|`
+type SeccompRuleArg struct {
+	Index uint   `yaml:"index" json:"index"`
+	Op    string `yaml:"op" json:"op"`
+	Value string `yaml:"value" json:"value"`
+	// Mask is only used by masked_eq, the argument matches if arg & mask == value
+	Mask string `yaml:"mask" json:"mask"`
+}
+
+const (
+	OP_EQUAL         = "eq"
+	OP_NOT_EQUAL     = "ne"
+	OP_LESS          = "lt"
+	OP_LESS_EQUAL    = "le"
+	OP_GREATER       = "gt"
+	OP_GREATER_EQUAL = "ge"
+	OP_MASKED_EQUAL  = "masked_eq"
+)
+
+const (
+	PR_SET_VMA = 0x53564d41
+)
+
+// ARG_CONSTANTS are the names which can be used as argument values in rules
+var ARG_CONSTANTS = map[string]uint64{
+	// socket families
+	"AF_UNIX":    syscall.AF_UNIX,
+	"AF_INET":    syscall.AF_INET,
+	"AF_INET6":   syscall.AF_INET6,
+	"AF_NETLINK": syscall.AF_NETLINK,
+	"AF_PACKET":  syscall.AF_PACKET,
+
+	// clone flags
+	"CLONE_NEWNS":     syscall.CLONE_NEWNS,
+	"CLONE_NEWCGROUP": 0x02000000,
+	"CLONE_NEWUTS":    syscall.CLONE_NEWUTS,
+	"CLONE_NEWIPC":    syscall.CLONE_NEWIPC,
+	"CLONE_NEWUSER":   syscall.CLONE_NEWUSER,
+	"CLONE_NEWPID":    syscall.CLONE_NEWPID,
+	"CLONE_NEWNET":    syscall.CLONE_NEWNET,
+	"CLONE_NEWTIME":   0x00000080,
+	"CLONE_THREAD":    syscall.CLONE_THREAD,
+
+	// ioctl requests
+	"TIOCSTI": syscall.TIOCSTI,
+
+	// prctl options
+	"PR_GET_DUMPABLE":     syscall.PR_GET_DUMPABLE,
+	"PR_SET_DUMPABLE":     syscall.PR_SET_DUMPABLE,
+	"PR_GET_NAME":         syscall.PR_GET_NAME,
+	"PR_SET_NAME":         syscall.PR_SET_NAME,
+	"PR_GET_SECCOMP":      syscall.PR_GET_SECCOMP,
+	"PR_CAPBSET_READ":     syscall.PR_CAPBSET_READ,
+	"PR_SET_NO_NEW_PRIVS": 0x26,
+	"PR_GET_NO_NEW_PRIVS": 0x27,
+	"PR_SET_VMA":          PR_SET_VMA,
+}
+
+// ParseArgValue parses a number or constant names combined with `|`, e.g. CLONE_NEWNS|CLONE_NEWUSER
+func ParseArgValue(value string) (uint64, error) {
+	result := uint64(0)
+	for _, part := range strings.Split(value, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return 0, fmt.Errorf("invalid argument value %q", value)
+		}
+
+		if constant, ok := ARG_CONSTANTS[part]; ok {
+			result |= constant
+			continue
+		}
+
+		num, err := strconv.ParseUint(part, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid argument value %q", value)
+		}
+		result |= num
+	}
+
+	return result, nil
+}
+
+func (r *SeccompRule) validate() error {
+	if strings.TrimSpace(r.Syscall) == "" {
+		return fmt.Errorf("rule without syscall name")
+	}
+
+	switch r.Action {
+	case ACTION_KILL_PROCESS, ACTION_KILL_THREAD, ACTION_ERRNO, ACTION_TRAP, ACTION_LOG, ACTION_ALLOW:
+	default:
+		return fmt.Errorf("rule of %s: unknown action %s", r.Syscall, r.Action)
+	}
+
+	if r.ErrnoCode < 0 || r.ErrnoCode > 0xffff {
+		return fmt.Errorf("rule of %s: invalid errno code %d", r.Syscall, r.ErrnoCode)
+	}
+
+	for _, arg := range r.Args {
+		if arg.Index > 5 {
+			return fmt.Errorf("rule of %s: invalid argument index %d", r.Syscall, arg.Index)
+		}
+
+		switch arg.Op {
+		case OP_EQUAL, OP_NOT_EQUAL, OP_LESS, OP_LESS_EQUAL, OP_GREATER, OP_GREATER_EQUAL:
+			if arg.Mask != "" {
+				return fmt.Errorf("rule of %s: mask is only supported by %s", r.Syscall, OP_MASKED_EQUAL)
+			}
+		case OP_MASKED_EQUAL:
+			if _, err := ParseArgValue(arg.Mask); err != nil {
+				return fmt.Errorf("rule of %s: %v", r.Syscall, err)
+			}
+		default:
+			return fmt.Errorf("rule of %s: unknown operator %s", r.Syscall, arg.Op)
+		}
+
+		if _, err := ParseArgValue(arg.Value); err != nil {
+			return fmt.Errorf("rule of %s: %v", r.Syscall, err)
+		}
+	}
+
+	return nil
+}
+
+// Denies reports whether the rule blocks the syscall instead of letting it through
+func (r *SeccompRule) Denies() bool {
+	return r.Action != ACTION_ALLOW && r.Action != ACTION_LOG
+}
@@ -0,0 +1,183 @@
+package seccomp_profile
+
+import (
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseArgValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected uint64
+		err      bool
+	}{
+		{value: "0", expected: 0},
+		{value: "42", expected: 42},
+		{value: "0x10", expected: 0x10},
+		{value: "AF_INET", expected: syscall.AF_INET},
+		{value: "PR_SET_VMA", expected: PR_SET_VMA},
+		{value: "CLONE_NEWNS|CLONE_NEWUSER", expected: syscall.CLONE_NEWNS | syscall.CLONE_NEWUSER},
+		{value: " CLONE_NEWNET | 0x1 ", expected: syscall.CLONE_NEWNET | 0x1},
+		{value: "", err: true},
+		{value: "CLONE_NEWNS|", err: true},
+		{value: "|CLONE_NEWNS", err: true},
+		{value: "AF_UNKNOWN", err: true},
+		{value: "af_inet", err: true},
+		{value: "-1", err: true},
+		{value: "0x10000000000000000", err: true},
+	}
+
+	for _, c := range cases {
+		value, err := ParseArgValue(c.value)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %#x", c.value, value)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", c.value, err)
+		} else if value != c.expected {
+			t.Errorf("%q: expected %#x, got %#x", c.value, c.expected, value)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	cases := []struct {
+		name  string
+		rules string
+		extra string
+		err   string
+	}{
+		{
+			name:  "allow and deny rules of the same syscall",
+			rules: "  - {syscall: socket, action: allow, args: [{index: 0, op: eq, value: AF_INET}]}\n  - {syscall: socket, action: errno, errno_code: 1, args: [{index: 0, op: eq, value: AF_NETLINK}]}\n",
+		},
+		{
+			name:  "masked_eq with a mask",
+			rules: "  - {syscall: clone, action: errno, errno_code: 1, args: [{index: 0, op: masked_eq, mask: CLONE_NEWUSER|CLONE_NEWNS, value: CLONE_NEWUSER}]}\n",
+		},
+		{
+			name:  "masked_eq without a mask",
+			rules: "  - {syscall: clone, action: errno, errno_code: 1, args: [{index: 0, op: masked_eq, value: CLONE_NEWUSER}]}\n",
+			err:   "invalid argument value",
+		},
+		{
+			name:  "mask of another operator",
+			rules: "  - {syscall: clone, action: errno, errno_code: 1, args: [{index: 0, op: eq, mask: '1', value: '1'}]}\n",
+			err:   "mask is only supported by masked_eq",
+		},
+		{
+			name:  "index out of range",
+			rules: "  - {syscall: ioctl, action: errno, errno_code: 1, args: [{index: 6, op: eq, value: TIOCSTI}]}\n",
+			err:   "invalid argument index 6",
+		},
+		{
+			name:  "unknown operator",
+			rules: "  - {syscall: ioctl, action: errno, errno_code: 1, args: [{index: 1, op: contains, value: TIOCSTI}]}\n",
+			err:   "unknown operator contains",
+		},
+		{
+			name:  "unknown constant",
+			rules: "  - {syscall: ioctl, action: errno, errno_code: 1, args: [{index: 1, op: eq, value: TIOCNOPE}]}\n",
+			err:   "invalid argument value",
+		},
+		{
+			name:  "unknown action",
+			rules: "  - {syscall: ioctl, action: deny, args: [{index: 1, op: eq, value: TIOCSTI}]}\n",
+			err:   "unknown action deny",
+		},
+		{
+			name:  "unknown syscall",
+			rules: "  - {syscall: not_a_syscall, action: allow, args: [{index: 0, op: eq, value: '0'}]}\n",
+			err:   "unknown syscall not_a_syscall",
+		},
+		{
+			name:  "missing syscall",
+			rules: "  - {action: allow, args: [{index: 0, op: eq, value: '0'}]}\n",
+			err:   "rule without syscall name",
+		},
+		{
+			name:  "default action",
+			rules: "  - {syscall: socket, action: kill_process, args: [{index: 0, op: eq, value: AF_PACKET}]}\n",
+			err:   "has the default action",
+		},
+		{
+			name:  "allowed unconditionally and denied by a rule",
+			extra: "allow: [socket]\n",
+			rules: "  - {syscall: socket, action: errno, errno_code: 1, args: [{index: 0, op: eq, value: AF_NETLINK}]}\n",
+			err:   "must not be listed unconditionally",
+		},
+		{
+			name:  "denied unconditionally and allowed by a rule",
+			extra: "kill: [prctl]\n",
+			rules: "  - {syscall: prctl, action: allow, args: [{index: 0, op: eq, value: PR_GET_NAME}]}\n",
+			err:   "must not be listed unconditionally",
+		},
+		{
+			name:  "rule without conditions besides conditional ones",
+			rules: "  - {syscall: prctl, action: errno, errno_code: 1}\n  - {syscall: prctl, action: allow, args: [{index: 0, op: eq, value: PR_GET_NAME}]}\n",
+			err:   "has a rule without conditions",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseProfile([]byte("name: test\n" + c.extra + "rules:\n" + c.rules))
+			if c.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("expected an error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestRuleDenies(t *testing.T) {
+	for action, denies := range map[string]bool{
+		ACTION_ALLOW:        false,
+		ACTION_LOG:          false,
+		ACTION_ERRNO:        true,
+		ACTION_TRAP:         true,
+		ACTION_KILL_THREAD:  true,
+		ACTION_KILL_PROCESS: true,
+	} {
+		rule := SeccompRule{Syscall: "socket", Action: action}
+		if rule.Denies() != denies {
+			t.Errorf("rule with action %s: expected denies to be %v", action, denies)
+		}
+	}
+}
+
+// TestBuiltinProfiles validates the tiers of every architecture, not only the embedded ones
+func TestBuiltinProfiles(t *testing.T) {
+	for _, arch := range []string{"amd64", "arm64"} {
+		for _, tier := range SECURITY_PROFILES {
+			name := SecurityProfileName("python3", tier)
+			t.Run(arch+"/"+name, func(t *testing.T) {
+				data, err := os.ReadFile(path.Join("builtin", arch, name+".yaml"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				profile, err := ParseProfile(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if profile.Name != name {
+					t.Fatalf("profile in %s.yaml is named %s", name, profile.Name)
+				}
+			})
+		}
+	}
+}
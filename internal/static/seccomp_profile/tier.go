@@ -0,0 +1,53 @@
+package seccomp_profile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// security profiles are the built-in tiers a request can choose from, ordered from the most restrictive
+const (
+	SECURITY_PROFILE_STRICT     = "strict"
+	SECURITY_PROFILE_STANDARD   = "standard"
+	SECURITY_PROFILE_PERMISSIVE = "permissive"
+)
+
+var SECURITY_PROFILES = []string{
+	SECURITY_PROFILE_STRICT,
+	SECURITY_PROFILE_STANDARD,
+	SECURITY_PROFILE_PERMISSIVE,
+}
+
+var (
+	ErrUnknownSecurityProfile = errors.New("unknown security profile")
+)
+
+// SecurityProfileLevel returns the position of a tier, a higher level is less restrictive
+func SecurityProfileLevel(tier string) (int, error) {
+	for level, name := range SECURITY_PROFILES {
+		if name == tier {
+			return level, nil
+		}
+	}
+
+	return -1, fmt.Errorf("%w: %s", ErrUnknownSecurityProfile, tier)
+}
+
+// SecurityProfileName returns the name of the built-in profile of a tier for a runtime, e.g. python3-strict
+func SecurityProfileName(language string, tier string) string {
+	return fmt.Sprintf("%s-%s", language, tier)
+}
+
+// the built-in profiles are registered first, so profiles with the same name in seccomp_profile_dir replace them
+func init() {
+	dir, err := fs.Sub(builtin_fs, builtin_dir)
+	if err != nil {
+		panic(err)
+	}
+
+	err = loadFS(dir)
+	if err != nil {
+		panic(err)
+	}
+}
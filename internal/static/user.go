@@ -4,3 +4,6 @@ const SANDBOX_USER = "sandbox"
 const SANDBOX_USER_UID = 65537
 
 var SANDBOX_GROUP_ID = 0
+
+// SANDBOX_ROOTLESS is set when executions are isolated with user namespaces instead of a dedicated host user
+var SANDBOX_ROOTLESS = false
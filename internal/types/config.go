@@ -12,14 +12,50 @@ type DifySandboxGlobalConfigurations struct {
 	PythonPath               string   `yaml:"python_path"`
 	PythonLibPaths           []string `yaml:"python_lib_path"`
 	PythonPipMirrorURL       string   `yaml:"python_pip_mirror_url"`
+	PythonWheelhouse         string   `yaml:"python_wheelhouse"`
+	PythonRequireHashes      bool     `yaml:"python_require_hashes"`
+	PythonDependencyAllowlist string  `yaml:"python_dependency_allowlist"`
 	PythonDepsUpdateInterval string   `yaml:"python_deps_update_interval"`
+	PythonDepsUpdateJitter   string   `yaml:"python_deps_update_jitter"`
+	PythonDependencyProfiles map[string]PythonDependencyProfile `yaml:"python_dependency_profiles"`
 	NodejsPath               string   `yaml:"nodejs_path"`
+	NodejsNpmCache           string   `yaml:"nodejs_npm_cache"`
 	EnableNetwork            bool     `yaml:"enable_network"`
 	EnablePreload            bool     `yaml:"enable_preload"`
 	AllowedSyscalls          []int    `yaml:"allowed_syscalls"`
+	SeccompProfileDir        string   `yaml:"seccomp_profile_dir"`
+	SeccompProfiles          struct {
+		Python3 string `yaml:"python3"`
+		Nodejs  string `yaml:"nodejs"`
+	} `yaml:"seccomp_profiles"`
+	SecurityProfile          struct {
+		Default string `yaml:"default"`
+		Max     string `yaml:"max"`
+	} `yaml:"security_profile"`
+	Rootless                 bool     `yaml:"rootless"`
+	ScratchSize              int      `yaml:"scratch_size"`
+	ChrootVerification       struct {
+		OnStartup   bool   `yaml:"on_startup"`
+		Interval    string `yaml:"interval"`
+		AutoRebuild bool   `yaml:"auto_rebuild"`
+	} `yaml:"chroot_verification"`
+	SandboxUidPool           struct {
+		Start int `yaml:"start"`
+		Size  int `yaml:"size"`
+	} `yaml:"sandbox_uid_pool"`
 	Proxy                    struct {
 		Socks5 string `yaml:"socks5"`
 		Https  string `yaml:"https"`
 		Http   string `yaml:"http"`
 	} `yaml:"proxy"`
-}
\ No newline at end of file
+}
+
+// PythonDependencyProfile is a named set of packages built into its own chroot, requests select it with `profile`
+type PythonDependencyProfile struct {
+	// Requirements is the path of the requirements file, its packages are installed for this profile only
+	Requirements string `yaml:"requirements"`
+	// LibPaths replace python_lib_path in the chroot of the profile if set
+	LibPaths []string `yaml:"lib_paths"`
+	// SeccompProfile replaces the seccomp profile of python3 if set
+	SeccompProfile string `yaml:"seccomp_profile"`
+}
@@ -0,0 +1,38 @@
+package metrics
+
+/*
+	metrics module counts events of the sandbox in memory, counters are reset when the server restarts
+*/
+
+import "sync"
+
+type Counter struct {
+	lock   sync.Mutex
+	values map[string]int64
+}
+
+func NewCounter() *Counter {
+	return &Counter{
+		values: map[string]int64{},
+	}
+}
+
+func (c *Counter) Inc(label string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[label]++
+}
+
+// Values returns a copy of the counter per label
+func (c *Counter) Values() map[string]int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	values := make(map[string]int64, len(c.values))
+	for label, value := range c.values {
+		values[label] = value
+	}
+	return values
+}
+
+// BLOCKED_SYSCALLS counts the executions killed by seccomp per syscall name
+var BLOCKED_SYSCALLS = NewCounter()
@@ -1,6 +1,7 @@
 package integrationtests_test
 
 import (
+	"github.com/langgenius/dify-sandbox/internal/core/runner"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
 	"github.com/langgenius/dify-sandbox/internal/static"
 	"github.com/langgenius/dify-sandbox/internal/utils/log"
@@ -8,6 +9,8 @@ import (
 
 func init() {
 	static.InitConfig("conf/config.yaml")
+	static.SetupRunnerDependencies()
+	runner.Setup()
 
 	err := python.PreparePythonDependenciesEnv()
 	if err != nil {
@@ -1,11 +1,19 @@
 package integrationtests_test
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path"
 	"strings"
 	"testing"
 
+	"github.com/langgenius/dify-sandbox/internal/core/jobs"
+	nodejs_dependencies "github.com/langgenius/dify-sandbox/internal/core/runner/nodejs/dependencies"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/service"
+	"github.com/langgenius/dify-sandbox/internal/static"
 )
 
 func TestNodejsBasicTemplate(t *testing.T) {
@@ -79,3 +87,88 @@ console.log(JSON.stringify({"hello": "world"}));
 		}
 	})
 }
+
+// writeTestTarball packs a node module as npm pack does
+func writeTestTarball(t *testing.T, target string, name string, version string) {
+	file, err := os.Create(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	compressed := gzip.NewWriter(file)
+	archive := tar.NewWriter(compressed)
+	for name, content := range map[string]string{
+		"package/package.json": fmt.Sprintf(`{"name": %q, "version": %q, "main": "index.js"}`, name, version),
+		"package/index.js":     fmt.Sprintf("module.exports.VERSION = %q\n", version),
+	} {
+		err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = archive.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := compressed.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNodejsDependencies(t *testing.T) {
+	err := os.MkdirAll(path.Dir(static.NODEJS_REQUIREMENTS_PATH), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Dir(static.NODEJS_REQUIREMENTS_PATH))
+	defer static.SetupRunnerDependencies()
+
+	// file: dependencies are relative to the requirements
+	writeTestTarball(t, path.Join(path.Dir(static.NODEJS_REQUIREMENTS_PATH), "dify-sandbox-test-module-1.0.0.tgz"), "dify-sandbox-test-module", "1.0.0")
+	err = os.WriteFile(static.NODEJS_REQUIREMENTS_PATH, []byte(`{"dependencies": {"dify-sandbox-test-module": "file:dify-sandbox-test-module-1.0.0.tgz"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = static.SetupRunnerDependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(nodejs_dependencies.PACKAGES_PATH)
+
+	resp := service.RefreshNodejsDependencies("")
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+	job, ok := jobs.Get(resp.Data.(*service.DependencyJobResponse).Job.ID)
+	if !ok {
+		t.Fatal("the job does not exist")
+	}
+	job.Wait()
+
+	snapshot := job.Snapshot(true)
+	if snapshot.Status != jobs.STATUS_SUCCEEDED {
+		t.Fatalf("job failed: %s\n%s", snapshot.Error, snapshot.Logs)
+	}
+	if snapshot.Language != service.LANGUAGE_NODEJS || fmt.Sprint(snapshot.Changes) != "[{ dify-sandbox-test-module  1.0.0}]" {
+		t.Fatalf("unexpected job: %v", snapshot)
+	}
+
+	resp = service.ListNodejsDependencies("")
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+	dependencies := resp.Data.(*service.ListDependenciesResponse).Dependencies
+	if fmt.Sprint(dependencies) != "[{dify-sandbox-test-module 1.0.0 file:dify-sandbox-test-module-1.0.0.tgz []}]" {
+		t.Fatalf("unexpected dependencies: %v", dependencies)
+	}
+
+	resp = service.ListNodejsDependencies("isolated")
+	if resp.Code != -400 {
+		t.Fatalf("a dependency profile was accepted for nodejs: %v", resp)
+	}
+}
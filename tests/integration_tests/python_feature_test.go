@@ -1,12 +1,20 @@
 package integrationtests_test
 
 import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/langgenius/dify-sandbox/internal/core/jobs"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/service"
+	"github.com/langgenius/dify-sandbox/internal/static"
+	sandbox_types "github.com/langgenius/dify-sandbox/internal/types"
 )
 
 func TestPythonBase64(t *testing.T) {
@@ -130,3 +138,524 @@ print(datetime.now(ZoneInfo("Asia/Shanghai")).isoformat())
 		}
 	})
 }
+
+func TestPythonLearnSeccompProfile(t *testing.T) {
+	resp := service.LearnSeccompProfile("python3", "learned", `
+import os
+print(os.getppid() >= 0)
+	`, false)
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	result := resp.Data.(*service.LearnSeccompProfileResponse)
+	if result.Stdout != "True\n" {
+		t.Fatalf("unexpected output: %s, error: %s\n", result.Stdout, result.Stderr)
+	}
+
+	if err := result.Profile.Validate(); err != nil {
+		t.Fatalf("learned profile is invalid: %v\n", err)
+	}
+
+	allowed := strings.Join(result.Profile.Allow, ",")
+	for _, name := range []string{"getppid", "write", "exit_group"} {
+		if !strings.Contains(","+allowed+",", ","+name+",") {
+			t.Fatalf("syscall %s was not learned: %s\n", name, allowed)
+		}
+	}
+}
+
+func TestPythonScratchDirectory(t *testing.T) {
+	resp := service.RunPython3Code(`
+import os
+import tempfile
+print(os.getcwd(), os.path.exists("leftover"))
+os.mkdir("work")
+with open("work/leftover", "w") as f:
+    f.write("ok")
+os.rename("work/leftover", "leftover")
+os.rmdir("work")
+with tempfile.TemporaryDirectory() as tmp:
+    print(tmp.startswith("/tmp/"))
+	`, "", &types.RunnerOptions{})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	// nothing written by the first execution is visible to the second one
+	runMultipleTestings(t, 1, func(t *testing.T) {
+		resp := service.RunPython3Code(`
+import os
+print(os.getcwd(), os.path.exists("leftover"))
+		`, "", &types.RunnerOptions{})
+		if resp.Code != 0 {
+			t.Fatal(resp)
+		}
+
+		if resp.Data.(*service.RunCodeResponse).Stdout != "/tmp False\n" {
+			t.Fatalf("unexpected output: %s, error: %s\n",
+				resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+		}
+	})
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "/tmp False\nTrue\n" {
+		t.Fatalf("unexpected output: %s, error: %s\n",
+			resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonScratchQuota(t *testing.T) {
+	if static.SANDBOX_ROOTLESS {
+		t.Skip("the scratch directory is mounted by the sandboxed process in rootless mode")
+	}
+
+	resp := service.RunPython3Code(`
+with open("large", "wb") as f:
+    while True:
+        f.write(b"0" * 1024 * 1024)
+	`, "", &types.RunnerOptions{})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if !strings.Contains(resp.Data.(*service.RunCodeResponse).Stderr, "scratch directory quota of 64MB exceeded") {
+		t.Fatalf("unexpected error: %s\n", resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonEnvVersions(t *testing.T) {
+	const marker = "dify-version-marker"
+	const release = "dify-version-release"
+	check_marker := "import os\nprint(os.path.exists('/" + marker + "'))\n"
+
+	env, err := python.GetEnv("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a marker is drift, verifying with rebuild replaces the version with one lacking it
+	replace := func() int {
+		active, _ := env.Versions.Active()
+		err := os.WriteFile(path.Join(env.Versions.Path(active), marker), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = env.Verify(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return active
+	}
+
+	first, _ := env.Versions.Active()
+	err = os.WriteFile(path.Join(env.Versions.Path(first), marker), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the execution outlasts the two rebuilds below, rebuilds seeded with copies take a while so
+	// it waits for the release file to show up in its version instead of sleeping
+	running := make(chan string)
+	go func() {
+		resp := service.RunPython3Code(
+			"import os, time\nwhile not os.path.exists('/"+release+"'):\n    time.sleep(0.1)\n"+check_marker,
+			"", &types.RunnerOptions{},
+		)
+		if resp.Code != 0 {
+			running <- resp.Message
+			return
+		}
+		running <- resp.Data.(*service.RunCodeResponse).Stdout
+	}()
+	time.Sleep(time.Second)
+
+	// neither active nor previous anymore, but still used by the running execution
+	_, err = env.Verify(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := replace()
+	if _, err := os.Stat(env.Versions.Path(first)); err != nil {
+		t.Fatalf("environment v%d was removed while in use: %v", first, err)
+	}
+	err = os.WriteFile(path.Join(env.Versions.Path(first), release), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output := <-running; output != "True\n" {
+		t.Fatalf("execution did not keep its environment: %s", output)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(env.Versions.Path(first)); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unused environment v%d was not removed", first)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// the previous version still has the marker, a second rollback undoes the first
+	for _, expected := range []string{"True\n", "False\n"} {
+		resp := service.RollbackPython3Chroot("")
+		if resp.Code != 0 {
+			t.Fatal(resp)
+		}
+
+		resp = service.RunPython3Code(check_marker, "", &types.RunnerOptions{})
+		if resp.Code != 0 {
+			t.Fatal(resp)
+		}
+		if resp.Data.(*service.RunCodeResponse).Stdout != expected {
+			t.Fatalf("unexpected output: %s, error: %s\n",
+				resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+		}
+	}
+
+	if active, previous := env.Versions.Active(); previous != second || active == second {
+		t.Fatalf("unexpected versions after rolling back twice: v%d active, v%d previous", active, previous)
+	}
+}
+
+func TestPythonDependencyProfile(t *testing.T) {
+	env, err := python.GetEnv("isolated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a package installed for the profile only
+	module := path.Join(env.PackagesPath(), "dify_profile_test.py")
+	err = os.WriteFile(module, []byte("VALUE = 'isolated'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		os.Remove(module)
+		env.Prepare()
+	}()
+
+	err = env.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := `
+try:
+    import dify_profile_test
+    print(dify_profile_test.VALUE)
+except ImportError:
+    print("missing")
+	`
+	for profile, expected := range map[string]string{"isolated": "isolated\n", "": "missing\n"} {
+		resp := service.RunPython3Code(code, "", &types.RunnerOptions{DependencyProfile: profile})
+		if resp.Code != 0 {
+			t.Fatal(resp)
+		}
+
+		if resp.Data.(*service.RunCodeResponse).Stdout != expected {
+			t.Fatalf("unexpected output of profile %s: %s, error: %s\n", profile,
+				resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+		}
+	}
+
+	resp := service.RunPython3Code(code, "", &types.RunnerOptions{DependencyProfile: "unknown"})
+	if resp.Code != -400 {
+		t.Fatalf("unknown profile was accepted: %v", resp)
+	}
+
+	resp = service.ListPython3Dependencies("isolated")
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+}
+
+func TestPythonListDependencies(t *testing.T) {
+	env, err := python.GetEnv("isolated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// runs after the fake packages are removed
+	defer env.Prepare()
+
+	// dify-list-a requires b, c with its extra x and d with its extra y
+	distributions := map[string]string{
+		"dify_list_a-1.0": "Name: dify-list-a\nVersion: 1.0\nRequires-Dist: dify_list_b>=2\n" +
+			"Requires-Dist: dify-list-c; extra == \"x\"\nRequires-Dist: dify-list-d; extra == \"y\"\n\nRequires-Dist: ignored\n",
+		"dify_list_b-2.1": "Name: Dify_List_B\nVersion: 2.1\n",
+		"dify_list_c-3.0": "Name: dify-list-c\nVersion: 3.0\n",
+		"dify_list_d-4.0": "Name: dify-list-d\nVersion: 4.0\n",
+	}
+	for name, metadata := range distributions {
+		dist_info := path.Join(env.PackagesPath(), name+".dist-info")
+		err := os.MkdirAll(dist_info, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dist_info)
+
+		err = os.WriteFile(path.Join(dist_info, "METADATA"), []byte(metadata), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requirements := static.GetRunnerDependencies().PythonRequirements
+	original := requirements["isolated"]
+	requirements["isolated"] = "dify-list-a[x]==1.0 # pinned\n"
+	defer func() {
+		requirements["isolated"] = original
+	}()
+
+	err = env.Prepare()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := service.ListPython3Dependencies("isolated")
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	dependencies := map[string]string{}
+	for _, dependency := range resp.Data.(*service.ListDependenciesResponse).Dependencies {
+		dependencies[dependency.Name] = fmt.Sprint(dependency.Version, " ", dependency.Requirement, " ", dependency.RequiredBy)
+	}
+
+	expected := map[string]string{
+		"dify-list-a": "1.0 dify-list-a[x]==1.0 []",
+		"Dify_List_B": "2.1  [dify-list-a]",
+		"dify-list-c": "3.0  [dify-list-a]",
+		"dify-list-d": "4.0  []",
+	}
+	for name, dependency := range expected {
+		if dependencies[name] != dependency {
+			t.Fatalf("unexpected dependency %s: %s, expected %s", name, dependencies[name], dependency)
+		}
+	}
+
+	// packages of the interpreter are listed as well
+	if !strings.HasPrefix(dependencies["pip"], "2") {
+		t.Fatalf("pip is missing from the dependencies: %v", dependencies)
+	}
+}
+
+// writeTestWheel writes a wheel of a pure python package into the wheelhouse of the test config
+func writeTestWheel(t *testing.T, name string, version string) {
+	module := strings.ReplaceAll(name, "-", "_")
+	wheelhouse := static.GetDifySandboxGlobalConfigurations().PythonWheelhouse
+	err := os.MkdirAll(wheelhouse, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Create(path.Join(wheelhouse, fmt.Sprintf("%s-%s-py3-none-any.whl", module, version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	dist_info := fmt.Sprintf("%s-%s.dist-info", module, version)
+	files := map[string]string{
+		module + "/__init__.py": fmt.Sprintf("VERSION = %q\n", version),
+		dist_info + "/METADATA": fmt.Sprintf("Metadata-Version: 2.1\nName: %s\nVersion: %s\n", name, version),
+		dist_info + "/WHEEL":    "Wheel-Version: 1.0\nGenerator: dify-sandbox\nRoot-Is-Purelib: true\nTag: py3-none-any\n",
+		dist_info + "/RECORD":   "",
+	}
+	record := ""
+	for name := range files {
+		record += name + ",,\n"
+	}
+	files[dist_info+"/RECORD"] = record
+
+	archive := zip.NewWriter(file)
+	for name, content := range files {
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(content))
+	}
+
+	err = archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPythonRuntimeDependencies(t *testing.T) {
+	writeTestWheel(t, "dify-sandbox-test-package", "1.0")
+	defer os.RemoveAll(static.GetDifySandboxGlobalConfigurations().PythonWheelhouse)
+
+	requirements_path := static.PythonRequirementsPath("isolated")
+	original, err := os.ReadFile(requirements_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer static.SetPythonRequirements("isolated", string(original))
+
+	for requirement, message := range map[string]string{
+		"dify-sandbox-test-package==2.0": "version 2.0 is not allowed",
+		"requests":                       "requests is not in the python dependency allowlist",
+		"dify-sandbox-test-package @ https://example.com/package.whl": "url",
+	} {
+		resp := service.AddPython3Dependency("isolated", requirement, nil)
+		if resp.Code != -400 || !strings.Contains(resp.Message, message) {
+			t.Fatalf("adding %s was not rejected with %s: %v", requirement, message, resp)
+		}
+	}
+
+	code := `
+try:
+    import dify_sandbox_test_package
+    print(dify_sandbox_test_package.VERSION)
+except ImportError:
+    print("missing")
+	`
+	run := func(expected string) {
+		resp := service.RunPython3Code(code, "", &types.RunnerOptions{DependencyProfile: "isolated"})
+		if resp.Code != 0 {
+			t.Fatal(resp)
+		}
+		if resp.Data.(*service.RunCodeResponse).Stdout != expected {
+			t.Fatalf("unexpected output: %s, error: %s\n",
+				resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+		}
+	}
+	wait := func(resp *sandbox_types.DifySandboxResponse) jobs.Snapshot {
+		if resp.Code != 0 {
+			t.Fatal(resp)
+		}
+
+		job, ok := jobs.Get(resp.Data.(*service.DependencyJobResponse).Job.ID)
+		if !ok {
+			t.Fatal("the job does not exist")
+		}
+		job.Wait()
+
+		resp = service.GetDependencyJob(job.ID())
+		snapshot := resp.Data.(*service.DependencyJobResponse).Job
+		if snapshot.Status != jobs.STATUS_SUCCEEDED {
+			t.Fatalf("job %s failed: %s\n%s", snapshot.Kind, snapshot.Error, snapshot.Logs)
+		}
+		return snapshot
+	}
+
+	added := wait(service.AddPython3Dependency("isolated", "dify-sandbox-test-package", nil))
+	if !strings.Contains(added.Logs, "Successfully installed dify-sandbox-test-package-1.0") {
+		t.Fatalf("unexpected logs of adding the package:\n%s", added.Logs)
+	}
+	if fmt.Sprint(added.Changes) != "[{isolated dify-sandbox-test-package  1.0}]" {
+		t.Fatalf("unexpected changes of adding the package: %v", added.Changes)
+	}
+	run("1.0\n")
+
+	// the requirement is persisted as narrowed by the allowlist
+	content, err := os.ReadFile(requirements_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(original)+"dify-sandbox-test-package>=1,<2\n" {
+		t.Fatalf("the requirement was not persisted:\n%s", content)
+	}
+
+	removed := wait(service.RemovePython3Dependency("isolated", "dify-sandbox-test-package"))
+	if fmt.Sprint(removed.Changes) != "[{isolated dify-sandbox-test-package 1.0 }]" {
+		t.Fatalf("unexpected changes of removing the package: %v", removed.Changes)
+	}
+	run("missing\n")
+
+	refreshed := wait(service.RefreshPython3Dependencies("isolated"))
+	if refreshed.Kind != service.JOB_REFRESH_DEPENDENCIES || len(refreshed.Changes) != 0 {
+		t.Fatalf("unexpected refresh job: %v", refreshed)
+	}
+
+	history := service.ListDependencyJobs().Data.(*service.DependencyJobsResponse).Jobs
+	kinds := []string{}
+	for _, job := range history {
+		if job.Logs != "" {
+			t.Fatalf("the job history contains logs: %v", job)
+		}
+		kinds = append(kinds, job.Kind)
+	}
+	if len(kinds) < 3 || strings.Join(kinds[:3], ",") != "refresh_dependencies,remove_dependency,add_dependency" {
+		t.Fatalf("unexpected job history: %v", kinds)
+	}
+
+	content, err = os.ReadFile(requirements_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(original) {
+		t.Fatalf("the requirement was not removed:\n%s", content)
+	}
+
+	resp := service.RemovePython3Dependency("isolated", "dify-sandbox-test-package")
+	if resp.Code != -400 {
+		t.Fatalf("removing a package which is not listed was accepted: %v", resp)
+	}
+
+	resp = service.GetDependencyJob("unknown")
+	if resp.Code != -404 {
+		t.Fatalf("an unknown job was found: %v", resp)
+	}
+}
+
+func TestPythonScheduledUpdate(t *testing.T) {
+	env, err := python.GetEnv("isolated")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output strings.Builder
+	_, err = python.UpdateChangedDependencies(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing changed since the environments were built
+	output.Reset()
+	updated, err := python.UpdateChangedDependencies(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 0 || !strings.Contains(output.String(), "python dependency profile isolated is unchanged") {
+		t.Fatalf("unchanged profiles were updated: %d\n%s", updated, output.String())
+	}
+
+	// comments are not part of the requirements
+	requirements := static.GetRunnerDependencies().PythonRequirements
+	original := requirements["isolated"]
+	requirements["isolated"] = original + "# another comment\n"
+	defer func() {
+		requirements["isolated"] = original
+	}()
+	if env.Changed() {
+		t.Fatal("a comment in the requirements changed the profile")
+	}
+
+	dist_info := path.Join(env.PackagesPath(), "dify_fingerprint-1.0.dist-info")
+	err = os.MkdirAll(dist_info, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Prepare()
+	defer os.RemoveAll(dist_info)
+
+	output.Reset()
+	updated, err = python.UpdateChangedDependencies(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 1 || !strings.Contains(output.String(), "python chroot environment isolated") {
+		t.Fatalf("the changed profile was not updated: %d\n%s", updated, output.String())
+	}
+
+	resp := service.GetDependencySchedule()
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+}
@@ -1,11 +1,20 @@
 package integrationtests_test
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
 	"strings"
+	"syscall"
 	"testing"
 
+	"github.com/langgenius/dify-sandbox/internal/core/lib"
+	"github.com/langgenius/dify-sandbox/internal/core/runner/python"
 	"github.com/langgenius/dify-sandbox/internal/core/runner/types"
 	"github.com/langgenius/dify-sandbox/internal/service"
+	"github.com/langgenius/dify-sandbox/internal/static"
+	"github.com/langgenius/dify-sandbox/internal/utils/metrics"
 )
 
 func TestSysFork(t *testing.T) {
@@ -75,3 +84,440 @@ print(open("/etc/passwd").read())
 		t.Error(resp.Data.(*service.RunCodeResponse).Stderr)
 	}
 }
+
+func TestPythonNetworkDisabled(t *testing.T) {
+	// network denial should be enforced by the network namespace
+	resp := service.RunPython3Code(`
+import socket
+s = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+s.settimeout(3)
+s.connect(("1.1.1.1", 80))
+print("connected")
+	`, "", &types.RunnerOptions{
+		EnableNetwork: false,
+	})
+	if resp.Code != 0 {
+		t.Error(resp)
+	}
+
+	if strings.Contains(resp.Data.(*service.RunCodeResponse).Stdout, "connected") {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout)
+	}
+}
+
+func TestPythonProcessIsolation(t *testing.T) {
+	// processes of other executions should not be visible
+	resp := service.RunPython3Code(`
+import os
+print([pid for pid in os.listdir("/proc") if pid.isdigit()])
+	`, "", &types.RunnerOptions{
+		EnableNetwork: true,
+	})
+	if resp.Code != 0 {
+		t.Error(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "['1']\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonStrictProcessSpawning(t *testing.T) {
+	// strict makes every attempt to spawn a process fail with EPERM
+	resp := service.RunPython3Code(`
+import os
+import subprocess
+try:
+	os.fork()
+	print("forked")
+except OSError as e:
+	print(e.errno)
+try:
+	subprocess.run(["ls"])
+	print("spawned")
+except OSError as e:
+	print(e.errno)
+try:
+	os.posix_spawn("/bin/ls", ["ls"], {})
+	print("spawned")
+except OSError as e:
+	print(e.errno)
+	`, "", &types.RunnerOptions{
+		EnableNetwork:   true,
+		SecurityProfile: "strict",
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "1\n1\n1\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonStrictSocket(t *testing.T) {
+	// strict denies sockets even if network is enabled
+	resp := service.RunPython3Code(`
+import socket
+try:
+	socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+	print("created")
+except OSError as e:
+	print(e.errno)
+try:
+	socket.socketpair()
+	print("created")
+except OSError as e:
+	print(e.errno)
+	`, "", &types.RunnerOptions{
+		EnableNetwork:   true,
+		SecurityProfile: "strict",
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "1\n1\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonSecurityProfileAboveMax(t *testing.T) {
+	// the maximum tier defaults to standard
+	resp := service.RunPython3Code(`print("hello")`, "", &types.RunnerOptions{
+		EnableNetwork:   true,
+		SecurityProfile: "permissive",
+	})
+	if resp.Code != -400 {
+		t.Error(resp)
+	}
+}
+
+func TestPythonSocketFamily(t *testing.T) {
+	// only internet sockets are allowed, netlink fails and raw packet sockets kill the process
+	resp := service.RunPython3Code(`
+import socket
+try:
+	socket.socket(socket.AF_NETLINK, socket.SOCK_RAW)
+	print("created")
+except OSError as e:
+	print(e.errno, flush=True)
+socket.socket(socket.AF_PACKET, socket.SOCK_RAW)
+print("created")
+	`, "", &types.RunnerOptions{
+		EnableNetwork: true,
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "97\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout)
+	}
+
+	if !strings.Contains(resp.Data.(*service.RunCodeResponse).Stderr, "operation not permitted") {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonCloneNamespace(t *testing.T) {
+	// creating namespaces with clone kills the process
+	resp := service.RunPython3Code(`
+import ctypes
+libc = ctypes.CDLL(None, use_errno=True)
+print("before", flush=True)
+libc.syscall(56, 0x10000000 | 17, 0, 0, 0, 0)
+print("cloned")
+	`, "", &types.RunnerOptions{
+		EnableNetwork: true,
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "before\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout)
+	}
+
+	if !strings.Contains(resp.Data.(*service.RunCodeResponse).Stderr, "operation not permitted") {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonIoctlTIOCSTI(t *testing.T) {
+	// terminal input injection fails, even with garbage in the upper bits of the request
+	resp := service.RunPython3Code(`
+import ctypes
+import fcntl
+import termios
+try:
+	fcntl.ioctl(0, termios.TIOCSTI, b"x")
+	print("injected")
+except OSError as e:
+	print(e.errno)
+libc = ctypes.CDLL(None, use_errno=True)
+libc.ioctl.argtypes = [ctypes.c_int, ctypes.c_ulong, ctypes.c_char_p]
+print(libc.ioctl(0, (1 << 32) | termios.TIOCSTI, b"x"), ctypes.get_errno())
+	`, "", &types.RunnerOptions{
+		EnableNetwork: true,
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "1\n-1 1\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonPrctl(t *testing.T) {
+	// prctl is limited to options which can not change privileges
+	resp := service.RunPython3Code(`
+import ctypes
+libc = ctypes.CDLL(None, use_errno=True)
+print(libc.prctl(15, b"sandbox", 0, 0, 0), flush=True)
+libc.prctl(4, 1, 0, 0, 0)
+print("dumpable")
+	`, "", &types.RunnerOptions{
+		EnableNetwork: true,
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "0\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout)
+	}
+
+	if !strings.Contains(resp.Data.(*service.RunCodeResponse).Stderr, "operation not permitted") {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonThread(t *testing.T) {
+	// threads are allowed by clone flags
+	resp := service.RunPython3Code(`
+import threading
+result = []
+thread = threading.Thread(target=lambda: result.append(1))
+thread.start()
+thread.join()
+print(result)
+	`, "", &types.RunnerOptions{
+		EnableNetwork: true,
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "[1]\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonBlockedSyscallReport(t *testing.T) {
+	// the error names the syscall which got the process killed
+	resp := service.RunPython3Code(`
+import os
+os.execl("/bin/ls", "ls")
+	`, "", &types.RunnerOptions{
+		EnableNetwork: true,
+	})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if !strings.Contains(resp.Data.(*service.RunCodeResponse).Stderr, "syscall execve") {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+
+	if metrics.BLOCKED_SYSCALLS.Values()["execve"] == 0 {
+		t.Error("blocked syscall is not counted")
+	}
+}
+
+func TestPythonLandlock(t *testing.T) {
+	if lib.LandlockABI() == 0 {
+		t.Skip("landlock is not supported by the kernel")
+	}
+
+	// python.so is part of the chroot but not of the library paths
+	resp := service.RunPython3Code(`
+try:
+    open("/python.so", "rb")
+except PermissionError as e:
+    print(e.errno)
+with open("/tmp/scratch", "w") as f:
+    f.write("ok")
+with open("/tmp/scratch") as f:
+    print(f.read())
+	`, "", &types.RunnerOptions{})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "13\nok\n" {
+		t.Fatalf("unexpected output: %s, error: %s\n",
+			resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonPrivilegeDrop(t *testing.T) {
+	// real, effective, saved and filesystem ids, groups and every capability set of every thread,
+	// the threads of the runtime included
+	resp := service.RunPython3Code(`
+import os
+statuses = set()
+for tid in os.listdir("/proc/self/task"):
+    lines = []
+    with open("/proc/self/task/" + tid + "/status") as f:
+        for line in f:
+            name, _, value = line.partition(":")
+            if name in ("Uid", "Gid"):
+                ids = value.split()
+                lines.append("%s %s %s" % (name, len(set(ids)) == 1, ids[0] == "0"))
+            elif name == "Groups":
+                lines.append("%s %s" % (name, value.split()))
+            elif name in ("CapInh", "CapPrm", "CapEff", "CapBnd", "CapAmb"):
+                lines.append("%s %d" % (name, int(value, 16)))
+    statuses.add("\n".join(lines))
+print(len(os.listdir("/proc/self/task")) > 1)
+for status in statuses:
+    print(status)
+	`, "", &types.RunnerOptions{})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	// only root is mapped in the user namespace of rootless mode
+	root := "False"
+	if static.SANDBOX_ROOTLESS {
+		root = "True"
+	}
+
+	expected := fmt.Sprintf("True\nUid True %s\nGid True %s\nGroups []\nCapInh 0\nCapPrm 0\nCapEff 0\nCapBnd 0\nCapAmb 0\n", root, root)
+	if resp.Data.(*service.RunCodeResponse).Stdout != expected {
+		t.Fatalf("unexpected output: %s, error: %s\n",
+			resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+func TestPythonChrootIntegrity(t *testing.T) {
+	env, err := python.GetEnv("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// builds with other lib paths may have left files behind which the builder never recorded
+	_, err = env.Verify(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := env.Verify(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Intact() {
+		t.Fatalf("rebuilt environment drifted: %+v", result)
+	}
+
+	// a dropped .pth file runs on every interpreter start, a tampered python.so skips the sandbox
+	active, _ := env.Versions.Active()
+	env_path := env.Versions.Path(active)
+	err = os.WriteFile(path.Join(env_path, "dify-integrity-test.pth"), []byte("import os\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(env_path, python.LIB_NAME), []byte("tampered"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = env.Verify(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(result.Added, result.Modified, result.Deleted) != "[/dify-integrity-test.pth] [/python.so] []" {
+		t.Fatalf("unexpected drift: %+v", result)
+	}
+
+	// the drifted version is replaced, not repaired in place
+	if rebuilt, _ := env.Versions.Active(); rebuilt == active {
+		t.Fatalf("environment v%d was not replaced", active)
+	}
+
+	result, err = env.Verify(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Intact() {
+		t.Fatalf("repaired environment drifted: %+v", result)
+	}
+}
+
+func TestPythonSyscallReportClosed(t *testing.T) {
+	// neither the report socket nor the seccomp listener is left to untrusted code
+	resp := service.RunPython3Code(`
+import os
+for fd in os.listdir("/proc/self/fd"):
+    try:
+        link = os.readlink("/proc/self/fd/" + fd)
+    except OSError:
+        continue
+    if link.startswith("socket:") or "seccomp" in link:
+        print(fd, link)
+print("ok")
+	`, "", &types.RunnerOptions{})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	if resp.Data.(*service.RunCodeResponse).Stdout != "ok\n" {
+		t.Error(resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}
+
+// userNamespaceAvailable spawns a process in a user namespace like the executions of rootless mode
+func userNamespaceAvailable() bool {
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Geteuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getegid(), Size: 1}},
+	}
+	return cmd.Run() == nil
+}
+
+func TestPythonRootless(t *testing.T) {
+	if lib.LandlockABI() == 0 || !userNamespaceAvailable() {
+		t.Skip("rootless mode needs user namespaces and landlock")
+	}
+
+	previous := static.SANDBOX_ROOTLESS
+	static.SANDBOX_ROOTLESS = true
+	defer func() {
+		static.SANDBOX_ROOTLESS = previous
+	}()
+
+	// root inside the user namespace is the server user, no other id is mapped to switch to
+	resp := service.RunPython3Code(`
+import os
+print(os.getuid(), os.getgid())
+with open("/proc/self/uid_map") as f:
+    print(" ".join(f.read().split()))
+with open("/tmp/rootless", "w") as f:
+    f.write("ok")
+with open("/tmp/rootless") as f:
+    print(f.read())
+	`, "", &types.RunnerOptions{})
+	if resp.Code != 0 {
+		t.Fatal(resp)
+	}
+
+	expected := fmt.Sprintf("0 0\n0 %d 1\nok\n", os.Geteuid())
+	if resp.Data.(*service.RunCodeResponse).Stdout != expected {
+		t.Fatalf("unexpected output: %s, error: %s\n",
+			resp.Data.(*service.RunCodeResponse).Stdout, resp.Data.(*service.RunCodeResponse).Stderr)
+	}
+}